@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogParams is what an access log format renders: gin's formatter
+// params, so custom templates read like gin.LoggerWithFormatter ones, plus
+// the full entry as Entry.
+type accessLogParams struct {
+	gin.LogFormatterParams
+	Entry accessLogEntry
+}
+
+// accessLogFormat renders one access log line, including the newline.
+type accessLogFormat func(p *accessLogParams) ([]byte, error)
+
+// accessLogFormats are the built-in formats, selected by name with
+// servers.*.access_log. log.formats adds text/template ones.
+var accessLogFormats = map[string]accessLogFormat{
+	"json":     jsonAccessLog,
+	"common":   commonAccessLog,
+	"combined": combinedAccessLog,
+	"logfmt":   logfmtAccessLog,
+}
+
+// accessLogFormatNames lists the built-in and custom formats of cfg.
+func accessLogFormatNames(cfg LogConfig) []string {
+	var names []string
+	for name := range accessLogFormats {
+		names = append(names, name)
+	}
+	for name := range cfg.Formats {
+		if _, builtin := accessLogFormats[name]; !builtin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupAccessLogFormat returns the format called name, JSON when name is
+// empty. Custom formats see the request with cfg.Redact applied.
+func lookupAccessLogFormat(cfg LogConfig, name string) (accessLogFormat, error) {
+	if name == "" {
+		name = "json"
+	}
+	if f, ok := accessLogFormats[name]; ok {
+		return f, nil
+	}
+	text, ok := cfg.Formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown access log format %q", name)
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	red := newRedactor(cfg.Redact)
+	return func(p *accessLogParams) ([]byte, error) {
+		if p.Request != nil {
+			req := *p.Request
+			req.Header = red.Header(p.Request.Header)
+			u := *p.Request.URL
+			u.RawQuery = red.Query(u.RawQuery)
+			req.URL = &u
+			p.Request = &req
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, p); err != nil {
+			return nil, err
+		}
+		if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
+
+func jsonAccessLog(p *accessLogParams) ([]byte, error) {
+	b, err := json.Marshal(p.Entry)
+	return append(b, '\n'), err
+}
+
+// commonAccessLog is the Apache Common Log Format.
+func commonAccessLog(p *accessLogParams) ([]byte, error) {
+	var b strings.Builder
+	writeCommon(&b, p)
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+// combinedAccessLog is the Apache Combined Log Format.
+func combinedAccessLog(p *accessLogParams) ([]byte, error) {
+	var b strings.Builder
+	writeCommon(&b, p)
+	fmt.Fprintf(&b, " %s %s\n", quoteOrDash(p.Request.Referer()), quoteOrDash(p.Request.UserAgent()))
+	return []byte(b.String()), nil
+}
+
+func writeCommon(b *strings.Builder, p *accessLogParams) {
+	user := p.Entry.User
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if p.BodySize > 0 {
+		size = strconv.Itoa(p.BodySize)
+	}
+	fmt.Fprintf(b, "%s - %s [%s] \"%s %s %s\" %d %s",
+		p.ClientIP, user, p.Entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		p.Method, p.Path, p.Request.Proto, p.StatusCode, size)
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strconv.Quote(s)
+}
+
+// logfmtAccessLog writes the entry as key=value pairs.
+func logfmtAccessLog(p *accessLogParams) ([]byte, error) {
+	e := p.Entry
+	var b strings.Builder
+	pair := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " \"=\\") || strings.IndexFunc(value, func(r rune) bool { return r < ' ' }) >= 0 {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', 3, 64) }
+
+	pair("time", e.Time.Format(time.RFC3339Nano))
+	pair("level", e.Level.String())
+	if e.RequestID != "" {
+		pair("request_id", e.RequestID)
+	}
+	pair("method", e.Method)
+	pair("route", e.Route)
+	pair("path", e.Path)
+	if e.Query != "" {
+		pair("query", e.Query)
+	}
+	pair("status", strconv.Itoa(e.Status))
+	pair("latency_ms", num(e.LatencyMS))
+	pair("bytes_in", strconv.FormatInt(e.BytesIn, 10))
+	pair("bytes_out", strconv.Itoa(e.BytesOut))
+	pair("client_ip", e.ClientIP)
+	pair("user_agent", e.UserAgent)
+	if e.User != "" {
+		pair("user", e.User)
+	}
+	if len(e.Errors) > 0 {
+		pair("errors", strings.Join(e.Errors, "; "))
+	}
+	if e.Timing != nil {
+		pair("handler", e.Handler)
+		pair("read_body_ms", num(e.Timing.ReadBodyMS))
+		pair("first_byte_ms", num(e.Timing.FirstByteMS))
+		pair("write_ms", num(e.Timing.WriteMS))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+// formatterParams fills gin.LogFormatterParams the way gin.Logger does,
+// with the query redacted. Keys is left out: it holds the session and the
+// Principal, which templates have no business printing.
+func formatterParams(c *gin.Context, e accessLogEntry, latency time.Duration) gin.LogFormatterParams {
+	path := e.Path
+	if e.Query != "" {
+		path += "?" + e.Query
+	}
+	return gin.LogFormatterParams{
+		Request:      c.Request,
+		TimeStamp:    time.Now(),
+		StatusCode:   e.Status,
+		Latency:      latency,
+		ClientIP:     e.ClientIP,
+		Method:       e.Method,
+		Path:         path,
+		ErrorMessage: c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		BodySize:     e.BytesOut,
+	}
+}
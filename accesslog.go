@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogEntry is one JSON line of the access log.
+type accessLogEntry struct {
+	Time time.Time `json:"time"`
+	// Level is error for 5xx responses, warn for slow requests and info
+	// otherwise. Entries below the level of the http module are dropped.
+	Level     Level    `json:"level"`
+	RequestID string   `json:"request_id,omitempty"`
+	Method    string   `json:"method"`
+	Route     string   `json:"route"`
+	Path      string   `json:"path"`
+	Query     string   `json:"query,omitempty"`
+	Status    int      `json:"status"`
+	LatencyMS float64  `json:"latency_ms"`
+	BytesIn   int64    `json:"bytes_in"`
+	BytesOut  int      `json:"bytes_out"`
+	ClientIP  string   `json:"client_ip"`
+	UserAgent string   `json:"user_agent"`
+	User      string   `json:"user,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+
+	// Handler and Timing are only reported for slow requests.
+	Handler string         `json:"handler,omitempty"`
+	Timing  *requestTiming `json:"timing,omitempty"`
+}
+
+// requestTiming breaks down where a request spent its time.
+type requestTiming struct {
+	ReadBodyMS  float64 `json:"read_body_ms"`
+	FirstByteMS float64 `json:"first_byte_ms"`
+	WriteMS     float64 `json:"write_ms"`
+}
+
+// countingReader counts the request body bytes the handlers read and the
+// time spent reading them.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+	d time.Duration
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.ReadCloser.Read(p)
+	r.d += time.Since(start)
+	r.n += int64(n)
+	return n, err
+}
+
+// timingWriter records when the first response byte was written and the
+// time spent writing.
+type timingWriter struct {
+	gin.ResponseWriter
+	start     time.Time
+	firstByte time.Duration
+	write     time.Duration
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	defer w.track(time.Now())
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	defer w.track(time.Now())
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) track(start time.Time) {
+	if w.firstByte == 0 {
+		w.firstByte = start.Sub(w.start)
+	}
+	w.write += time.Since(start)
+}
+
+// sampleRand decides which successful requests of a sampled route are
+// logged. Tests replace it.
+var sampleRand = rand.Float64
+
+// accessLog writes one line per request to out in the named format, see
+// accessLogFormats, with the query redacted as cfg.Redact says. Requests slower than their threshold are
+// logged as warnings with the handler and a timing breakdown; successful
+// requests of sampled routes are only logged at their sample rate. It
+// replaces gin.Logger, so every engine logs requests exactly once.
+func accessLog(out io.Writer, cfg LogConfig, format string) gin.HandlerFunc {
+	red := newRedactor(cfg.Redact)
+	render, err := lookupAccessLogFormat(cfg, format)
+	if err != nil {
+		// Validate rejects this, so it only happens with unchecked configs.
+		stdLogger("http").Errorf("access log: %v, using json", err)
+		render = jsonAccessLog
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+		writer := &timingWriter{ResponseWriter: c.Writer, start: start}
+		c.Writer = writer
+
+		c.Next()
+
+		latency := time.Since(start)
+		route := cfg.Routes[c.FullPath()]
+		threshold := cfg.SlowThreshold
+		if route.SlowThreshold > 0 {
+			threshold = route.SlowThreshold
+		}
+		slow := threshold > 0 && latency > threshold
+		failed := c.Writer.Status() >= 400 || len(c.Errors) > 0
+		if !slow && !failed && route.SampleRate != nil && sampleRand() >= *route.SampleRate {
+			return
+		}
+		level := LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = LevelError
+		case slow:
+			level = LevelWarn
+		}
+		if level < defaultLevels.Level("http") {
+			return
+		}
+
+		entry := accessLogEntry{
+			Time:      start,
+			Level:     level,
+			RequestID: c.GetString(requestIDKey),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			Path:      c.Request.URL.Path,
+			Query:     red.Query(c.Request.URL.RawQuery),
+			Status:    c.Writer.Status(),
+			LatencyMS: ms(latency),
+			BytesIn:   body.n,
+			BytesOut:  c.Writer.Size(),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			User:      c.GetString(gin.AuthUserKey),
+			Errors:    c.Errors.Errors(),
+		}
+		if entry.BytesOut < 0 {
+			entry.BytesOut = 0
+		}
+		if slow {
+			entry.Handler = c.HandlerName()
+			entry.Timing = &requestTiming{
+				ReadBodyMS:  ms(body.d),
+				FirstByteMS: ms(writer.firstByte),
+				WriteMS:     ms(writer.write),
+			}
+		}
+
+		// One Write per line keeps concurrent entries from interleaving.
+		line, err := render(&accessLogParams{formatterParams(c, entry, latency), entry})
+		if err != nil {
+			stdLogger("http").Errorf("access log: %v", err)
+			return
+		}
+		out.Write(line)
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogEntry(t *testing.T) {
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(accessLog(&out, DefaultConfig().Log, "json"))
+	router.POST("/user/:name", gin.BasicAuth(gin.Accounts{"foo": "bar"}), func(c *gin.Context) {
+		c.GetRawData()
+		c.Error(errors.New("boom"))
+		c.String(http.StatusCreated, "hello")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/user/lena?x=1", strings.NewReader("12345"))
+	req.SetBasicAuth("foo", "bar")
+	req.Header.Set("User-Agent", "test-agent")
+	perform(router, req)
+
+	var entry accessLogEntry
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "POST", entry.Method)
+	assert.Equal(t, "/user/:name", entry.Route)
+	assert.Equal(t, "/user/lena", entry.Path)
+	assert.Equal(t, "x=1", entry.Query)
+	assert.Equal(t, http.StatusCreated, entry.Status)
+	assert.Equal(t, int64(5), entry.BytesIn)
+	assert.Equal(t, 5, entry.BytesOut)
+	assert.Equal(t, "test-agent", entry.UserAgent)
+	assert.Equal(t, "foo", entry.User)
+	assert.Equal(t, []string{"boom"}, entry.Errors)
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+}
+
+func TestAccessLogSlowRequest(t *testing.T) {
+	var out bytes.Buffer
+	cfg := DefaultConfig().Log
+	cfg.Routes = map[string]RouteLogConfig{"/slow": {SlowThreshold: time.Millisecond}}
+	router := gin.New()
+	router.Use(accessLog(&out, cfg, "json"))
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	router.GET("/fast", func(c *gin.Context) {})
+
+	perform(router, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	var entry accessLogEntry
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, LevelWarn, entry.Level)
+	assert.Contains(t, entry.Handler, "TestAccessLogSlowRequest")
+	if assert.NotNil(t, entry.Timing) {
+		assert.GreaterOrEqual(t, entry.Timing.FirstByteMS, 5.0)
+	}
+
+	out.Reset()
+	perform(router, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	entry = accessLogEntry{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, LevelInfo, entry.Level)
+	assert.Nil(t, entry.Timing)
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	defer func(f func() float64) { sampleRand = f }(sampleRand)
+	sampleRand = func() float64 { return 0.5 }
+
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(accessLog(&out, DefaultConfig().Log, "json"))
+	router.GET("/ping", func(c *gin.Context) {
+		if c.Query("fail") != "" {
+			c.Status(http.StatusInternalServerError)
+		}
+	})
+
+	perform(router, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Zero(t, out.Len(), "sampled out")
+
+	perform(router, httptest.NewRequest(http.MethodGet, "/ping?fail=1", nil))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "errors are always logged")
+
+	sampleRand = func() float64 { return 0.001 }
+	perform(router, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, 2, strings.Count(out.String(), "\n"))
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	cfg := DefaultConfig().Log
+	cfg.Formats = map[string]string{"short": "{{.Method}} {{.Path}} {{.StatusCode}} {{.Request.Header.Get \"Authorization\"}}"}
+
+	for format, want := range map[string]string{
+		"common":   `192.0.2.1 - foo [` + `] "GET /user/lena?token=%5BREDACTED%5D HTTP/1.1" 200 5` + "\n",
+		"combined": `192.0.2.1 - foo [` + `] "GET /user/lena?token=%5BREDACTED%5D HTTP/1.1" 200 5 "http://example.com/" "test-agent"` + "\n",
+		"logfmt":   `method=GET route=/user/:name path=/user/lena query="token=%5BREDACTED%5D" status=200`,
+		"short":    "GET /user/lena?token=%5BREDACTED%5D 200 [REDACTED]\n",
+	} {
+		var out bytes.Buffer
+		router := gin.New()
+		router.Use(accessLog(&out, cfg, format))
+		router.GET("/user/:name", gin.BasicAuth(gin.Accounts{"foo": "bar"}), func(c *gin.Context) {
+			c.String(http.StatusOK, "hello")
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/user/lena?token=s3cret", nil)
+		req.SetBasicAuth("foo", "bar")
+		req.Header.Set("Referer", "http://example.com/")
+		req.Header.Set("User-Agent", "test-agent")
+		perform(router, req)
+
+		line := out.String()
+		if format == "common" || format == "combined" {
+			// Drop the timestamp between the brackets.
+			line = line[:strings.Index(line, "[")+1] + line[strings.Index(line, "]"):]
+		}
+		if format == "logfmt" {
+			assert.Contains(t, line, want, format)
+			assert.Contains(t, line, "level=info ", format)
+			continue
+		}
+		assert.Equal(t, want, line, format)
+	}
+}
+
+func TestAccessLogFormatConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Log.Formats = map[string]string{"broken": "{{.Method", "json": "{{.Path}}"}
+	cfg.Servers.Server01.AccessLog = "apache"
+
+	err := cfg.Validate()
+	assert.IsType(t, ConfigError{}, err)
+	assert.Len(t, err.(ConfigError), 3)
+}
+
+func TestAccessLogFormatKeys(t *testing.T) {
+	var out bytes.Buffer
+	cfg := DefaultConfig().Log
+	cfg.Formats = map[string]string{"keys": "{{.Keys}}"}
+	router := gin.New()
+	router.Use(accessLog(&out, cfg, "keys"))
+	router.GET("/", func(c *gin.Context) {
+		c.Set(principalKey, Principal{Subject: "lena"})
+	})
+
+	perform(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotContains(t, out.String(), "lena")
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	// apiVersionHeader selects the version of the /api routes and reports
+	// the version of every API response.
+	apiVersionHeader = "API-Version"
+	// apiVersionKey holds the resolved version in the gin context.
+	apiVersionKey = "api_version"
+	latestVersion = 2
+)
+
+// apiMediaType matches Accept values like application/vnd.gindemo.v2+json.
+var apiMediaType = regexp.MustCompile(`^application/vnd\.gindemo\.v(\d+)\+json$`)
+
+// apiVersion resolves the API version of a request. The /v1 and /v2 groups
+// pass their version as fixed; the /api group passes 0 and negotiates it
+// from Accept or API-Version, falling back to api.default_version.
+// Responses of deprecated versions carry Deprecation and Sunset headers and
+// link the route under latest, the base path of the latest version's group,
+// in place of base, the base path of the group itself.
+func apiVersion(fixed int, cfg APIConfig, base, latest string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := fixed
+		if version == 0 {
+			c.Header("Vary", "Accept, "+apiVersionHeader)
+			v, status, err := negotiateVersion(c.Request, cfg.DefaultVersion)
+			if err != nil {
+				c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			version = v
+		}
+
+		c.Set(apiVersionKey, version)
+		c.Header(apiVersionHeader, strconv.Itoa(version))
+		c.Header("Content-Type", fmt.Sprintf("application/vnd.gindemo.v%d+json; charset=utf-8", version))
+		if version == 1 {
+			if !cfg.V1Deprecated.IsZero() {
+				// RFC 9745: the date as seconds since the epoch.
+				c.Header("Deprecation", "@"+strconv.FormatInt(cfg.V1Deprecated.Unix(), 10))
+			}
+			if !cfg.V1Sunset.IsZero() {
+				c.Header("Sunset", cfg.V1Sunset.UTC().Format(http.TimeFormat))
+			}
+			successor := path.Join(latest, strings.TrimPrefix(c.FullPath(), base))
+			c.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		}
+		c.Next()
+	}
+}
+
+// negotiateVersion picks the version asked for by Accept or API-Version.
+// It returns the status to fail with when the request can't be served.
+func negotiateVersion(req *http.Request, fallback int) (int, int, error) {
+	fromAccept := 0
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if m := apiMediaType.FindStringSubmatch(mediaType); m != nil {
+			fromAccept, _ = strconv.Atoi(m[1])
+			if !supportedVersion(fromAccept) {
+				return 0, http.StatusNotAcceptable, fmt.Errorf("unsupported API version %d", fromAccept)
+			}
+			break
+		}
+	}
+
+	fromHeader := 0
+	if h := req.Header.Get(apiVersionHeader); h != "" {
+		v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(h), "v"))
+		if err != nil || !supportedVersion(v) {
+			return 0, http.StatusBadRequest, fmt.Errorf("unsupported API version %q", h)
+		}
+		fromHeader = v
+	}
+
+	switch {
+	case fromAccept != 0 && fromHeader != 0 && fromAccept != fromHeader:
+		return 0, http.StatusBadRequest, errors.New("Accept and API-Version ask for different versions")
+	case fromAccept != 0:
+		return fromAccept, 0, nil
+	case fromHeader != 0:
+		return fromHeader, 0, nil
+	}
+	return fallback, 0, nil
+}
+
+func supportedVersion(v int) bool {
+	return v >= 1 && v <= latestVersion
+}
+
+// message is what the submit and read endpoints store and return.
+type message struct {
+	ID      int64     `json:"id"`
+	Author  string    `json:"author"`
+	Text    string    `json:"text"`
+	Created time.Time `json:"created_at"`
+}
+
+var errMessageNotFound = errors.New("message not found")
+
+// messageService is the business logic shared by every API version.
+type messageService struct {
+	redis redis.Cmdable
+	clock func() time.Time
+}
+
+const (
+	messageSeqKey    = "gin-demo:messages:seq"
+	messageKeyPrefix = "gin-demo:message:"
+)
+
+func (s messageService) submit(ctx context.Context, author, text string) (message, error) {
+	id, err := s.redis.Incr(ctx, messageSeqKey).Result()
+	if err != nil {
+		return message{}, err
+	}
+	msg := message{ID: id, Author: author, Text: text, Created: s.clock().UTC()}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return message{}, err
+	}
+	if err := s.redis.Set(ctx, messageKeyPrefix+strconv.FormatInt(id, 10), b, 0).Err(); err != nil {
+		return message{}, err
+	}
+	return msg, nil
+}
+
+// count returns how many messages were ever submitted.
+func (s messageService) count(ctx context.Context) (int64, error) {
+	n, err := s.redis.Get(ctx, messageSeqKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (s messageService) read(ctx context.Context, id int64) (message, error) {
+	b, err := s.redis.Get(ctx, messageKeyPrefix+strconv.FormatInt(id, 10)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return message{}, errMessageNotFound
+	}
+	if err != nil {
+		return message{}, err
+	}
+	var msg message
+	err = json.Unmarshal(b, &msg)
+	return msg, err
+}
+
+// The request bodies of each version. v1 accepts JSON and forms, v2 only
+// JSON. The author is the authenticated principal.
+type (
+	submitV1 struct {
+		Message string `form:"message" json:"message" binding:"required"`
+	}
+	submitV2 struct {
+		Text string `json:"text" binding:"required,max=1000"`
+	}
+	readRequest struct {
+		ID int64 `form:"id" json:"id" binding:"required,min=1"`
+	}
+)
+
+// apiHandlers serves login, submit and read in the version resolved by
+// apiVersion. v1 keeps the flat responses of /loginJSON; v2 wraps results
+// in "data" and errors in "error" objects. submit and read are behind auth
+// and need the permissions of their unversioned twins. login starts a
+// session and issues tokens like /loginJSON.
+type apiHandlers struct {
+	svc      messageService
+	accounts *accounts
+	issuer   *jwtIssuer
+	auth     gin.HandlerFunc
+}
+
+// register adds the routes of version to router, 0 for negotiated ones.
+func (h apiHandlers) register(router *gin.RouterGroup, version int) {
+	router.POST("/login", binds(h.login, Login{}))
+	router.POST("/submit", h.auth, Require("messages:write"), binds(h.submit, submitV1{}, submitV2{}))
+	router.POST("/read", h.auth, Require("messages:read"), binds(h.read, readRequest{}))
+	switch version {
+	case 1:
+		bindsRoute(router, http.MethodPost, "/submit", submitV1{})
+	case 2:
+		bindsRoute(router, http.MethodPost, "/submit", submitV2{})
+	}
+}
+
+func (h apiHandlers) login(c *gin.Context) {
+	var login Login
+	var err error
+	if c.GetInt(apiVersionKey) == 1 {
+		err = c.ShouldBind(&login)
+	} else {
+		err = c.ShouldBindJSON(&login)
+	}
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, bindError(err))
+		return
+	}
+	pair, status, msg := startSession(c, h.accounts, h.issuer, login)
+	if status != 0 {
+		h.fail(c, status, msg)
+		return
+	}
+	if c.GetInt(apiVersionKey) == 1 {
+		c.JSON(http.StatusOK, loggedIn(pair))
+		return
+	}
+	data := gin.H{"user": login.User}
+	if pair != nil {
+		data["tokens"] = pair
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+func (h apiHandlers) submit(c *gin.Context) {
+	var text string
+	if c.GetInt(apiVersionKey) == 1 {
+		var req submitV1
+		if err := c.ShouldBind(&req); err != nil {
+			h.fail(c, http.StatusBadRequest, bindError(err))
+			return
+		}
+		text = req.Message
+	} else {
+		var req submitV2
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.fail(c, http.StatusBadRequest, bindError(err))
+			return
+		}
+		text = req.Text
+	}
+
+	principal, _ := principalFrom(c)
+	msg, err := h.svc.submit(c.Request.Context(), principal.Subject, text)
+	if err != nil {
+		c.Error(err)
+		h.fail(c, http.StatusInternalServerError, "could not store the message")
+		return
+	}
+	if c.GetInt(apiVersionKey) == 1 {
+		c.JSON(http.StatusOK, gin.H{"status": "submitted", "id": msg.ID})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": msg})
+}
+
+func (h apiHandlers) read(c *gin.Context) {
+	var req readRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.fail(c, http.StatusBadRequest, bindError(err))
+		return
+	}
+	msg, err := h.svc.read(c.Request.Context(), req.ID)
+	if errors.Is(err, errMessageNotFound) {
+		h.fail(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		h.fail(c, http.StatusInternalServerError, "could not read the message")
+		return
+	}
+	if c.GetInt(apiVersionKey) == 1 {
+		c.JSON(http.StatusOK, gin.H{"id": msg.ID, "author": msg.Author, "message": msg.Text})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": msg})
+}
+
+// fail writes an error in the shape of the request's version.
+func (h apiHandlers) fail(c *gin.Context, status int, msg string) {
+	if c.GetInt(apiVersionKey) == 1 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	c.JSON(status, gin.H{"error": gin.H{"status": status, "message": msg}})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIVersions(t *testing.T) {
+	router := NewRouter(testDeps())
+	post := func(path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return perform(router, req)
+	}
+
+	// submit and read need a token, the author is its subject.
+	assert.Equal(t, http.StatusUnauthorized, post("/v2/submit", `{"text": "hello"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/v1/read", `{"id": 1}`).Code)
+	assert.Equal(t, http.StatusForbidden, post("/v1/submit", `{"message": "hello"}`, "Authorization", "Bearer reader").Code)
+
+	w := post("/v1/submit", `{"author": "manu", "message": "hello"}`, "Authorization", "Bearer okay")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "submitted", "id": 1}`, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get(apiVersionHeader))
+	assert.Equal(t, "@1654041600", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Jun 2023 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v2/submit>; rel="successor-version"`, w.Header().Get("Link"))
+
+	// v2 reads what v1 wrote.
+	w = post("/v2/read", `{"id": 1}`, "Authorization", "Bearer okay")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data": {"id": 1, "author": "demo", "text": "hello", "created_at": "2022-06-01T00:00:00Z"}}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Equal(t, "application/vnd.gindemo.v2+json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = post("/v2/read", `{"id": 7}`, "Authorization", "Bearer okay")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": {"status": 404, "message": "message not found"}}`, w.Body.String())
+
+	// Logins start a session and issue tokens like /loginJSON.
+	w = post("/v1/login", `{"user": "manu", "password": "123"}`)
+	assert.Contains(t, w.Body.String(), `"status":"you are logged in"`)
+	var pair tokenPair
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	assert.Equal(t, "Authed pong for manu", post("/ping", "", "Authorization", "Bearer "+pair.AccessToken).Body.String())
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=")
+
+	w = post("/v2/login", `{"user": "manu", "password": "123"}`)
+	var v2 struct {
+		Data struct {
+			User   string    `json:"user"`
+			Tokens tokenPair `json:"tokens"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &v2))
+	assert.Equal(t, "manu", v2.Data.User)
+	assert.Equal(t, http.StatusOK, post("/ping", "", "Authorization", "Bearer "+v2.Data.Tokens.AccessToken).Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=")
+
+	w = post("/v2/login", `{"user": "manu", "password": "nope"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	router := NewRouter(testDeps())
+
+	for _, tc := range []struct {
+		header, value string
+		status        int
+		version       string
+	}{
+		{"", "", http.StatusOK, "2"},
+		{"Accept", "text/html, application/vnd.gindemo.v1+json;q=0.9", http.StatusOK, "1"},
+		{"API-Version", "1", http.StatusOK, "1"},
+		{"API-Version", "v2", http.StatusOK, "2"},
+		{"Accept", "application/vnd.gindemo.v3+json", http.StatusNotAcceptable, ""},
+		{"API-Version", "9", http.StatusBadRequest, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"user": "manu", "password": "123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		w := perform(router, req)
+		assert.Equal(t, tc.status, w.Code, tc.value)
+		assert.Equal(t, tc.version, w.Header().Get(apiVersionHeader), tc.value)
+		assert.Contains(t, w.Header().Get("Vary"), "Accept")
+	}
+
+	// v1 under /api links the v2 route, not itself.
+	req := httptest.NewRequest(http.MethodPost, "/api/read", strings.NewReader(`{"id": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(apiVersionHeader, "1")
+	assert.Equal(t, `</v2/read>; rel="successor-version"`, perform(router, req).Header().Get("Link"))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.Header.Set("Accept", "application/vnd.gindemo.v1+json")
+	req.Header.Set(apiVersionHeader, "2")
+	assert.Equal(t, http.StatusBadRequest, perform(router, req).Code)
+}
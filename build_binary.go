@@ -10,14 +10,15 @@ import (
 )
 
 // Build a single binary with templates
-func BuildMain() {
+func BuildMain() (*gin.Engine, error) {
 	r := gin.New()
 
 	t, err := loadTemplate()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	r.SetHTMLTemplate(t)
+	handleUnmatched(r, t)
 
 	r.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "/html/index.tmpl", gin.H{
@@ -31,7 +32,8 @@ func BuildMain() {
 		})
 	})
 
-	r.Run(":8080")
+	// r.Run(":8080")
+	return r, nil
 }
 
 func loadTemplate() (*template.Template, error) {
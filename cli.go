@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: gin-demo <command> [flags]
+
+Commands:
+  serve    run the servers (default)
+  routes   print the route table of every server
+  lint-routes
+           report ambiguous, shadowed and broken routes, failing on
+           problems missing from routes.baseline
+  check    load the config, parse all templates and ping Redis
+  encrypt-secret NAME
+           encrypt stdin for the encrypted secrets file
+
+Run "gin-demo <command> -h" for the flags of a command.
+`
+
+// runCommand dispatches args to a subcommand. Without one it serves, so
+// "gin-demo -config x.yaml" keeps working.
+func runCommand(args []string) error {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	switch name {
+	case "serve":
+		return serveCommand(args)
+	case "routes":
+		return routesCommand(os.Stdout, args)
+	case "lint-routes":
+		return lintRoutesCommand(os.Stdout, args)
+	case "check":
+		return checkCommand(os.Stdout, args)
+	case "encrypt-secret":
+		return encryptSecretCommand(os.Stdin, os.Stdout, args)
+	case "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func serveCommand(args []string) error {
+	load := func(errorHandling flag.ErrorHandling) (*Config, bool, error) {
+		fs := flag.NewFlagSet("serve", errorHandling)
+		singleBinary := fs.Bool("single-binary", false, "serve the embedded templates instead of the full route table")
+		cfg, err := LoadConfig(fs, args)
+		return cfg, *singleBinary, err
+	}
+
+	cfg, singleBinary, err := load(flag.ExitOnError)
+	if err != nil {
+		return err
+	}
+	return serve(cfg, singleBinary, func() (*Config, error) {
+		cfg, _, err := load(flag.ContinueOnError)
+		return cfg, err
+	})
+}
+
+func routesCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("routes", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	cfg, err := LoadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	deps, err := routeDeps(cfg)
+	if err != nil {
+		return err
+	}
+
+	routes := collectRoutes(deps)
+	switch *format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVER\tMETHOD\tPATH\tHANDLER\tGROUP\tAUTH\tBINDS")
+		for _, r := range routes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Server, r.Method, r.Path, r.Handler,
+				orDash(r.Group), orDash(r.Auth), orDash(strings.Join(r.Binds, ",")))
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(routes)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+// routeDeps returns the Deps to build the engines with, without
+// connecting to Redis. The route table needs no users, so the store starts
+// empty whatever users.seed_secret says.
+func routeDeps(cfg *Config) (Deps, error) {
+	secrets, err := newSecretProvider(cfg.Secrets)
+	if err != nil {
+		return Deps{}, err
+	}
+	opts, err := redisOptions(cfg.Redis, secrets)
+	if err != nil {
+		return Deps{}, err
+	}
+	return newDeps(cfg, newRedisClient(opts), secrets, newMemUsers())
+}
+
+// lintRoutesCommand reports route problems and fails on any the baseline
+// doesn't accept, so CI catches new ones.
+func lintRoutesCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("lint-routes", flag.ExitOnError)
+	baseline := fs.String("baseline", "routes.baseline", "file of accepted problems")
+	update := fs.Bool("update", false, "accept every current problem into the baseline")
+	cfg, err := LoadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	deps, err := routeDeps(cfg)
+	if err != nil {
+		return err
+	}
+
+	problems := lintRoutes(deps)
+	if *update {
+		f, err := os.Create(*baseline)
+		if err != nil {
+			return err
+		}
+		if err := writeRouteBaseline(f, problems); err != nil {
+			f.Close()
+			return err
+		}
+		fmt.Fprintf(w, "%d route problems accepted into %s\n", len(problems), *baseline)
+		return f.Close()
+	}
+
+	accepted, err := readRouteBaseline(*baseline)
+	if err != nil {
+		return err
+	}
+	fresh := newRouteProblems(problems, accepted)
+	for _, p := range fresh {
+		fmt.Fprintf(w, "new: %s\n", p)
+	}
+	current := map[string]bool{}
+	for _, p := range problems {
+		current[p.String()] = true
+	}
+	fixed := 0
+	for line := range accepted {
+		if !current[line] {
+			fixed++
+		}
+	}
+	fmt.Fprintf(w, "%d route problems, %d new, %d fixed since %s\n", len(problems), len(fresh), fixed, *baseline)
+	if len(fresh) > 0 {
+		return fmt.Errorf("%d new route problems", len(fresh))
+	}
+	return nil
+}
+
+func checkCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 3*time.Second, "how long to wait for Redis")
+	cfg, err := LoadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "config: ok")
+
+	var failed []string
+	secrets, err := newSecretProvider(cfg.Secrets)
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	opts, err := redisOptions(cfg.Redis, secrets)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "secrets: ok")
+
+	rdb := newRedisClient(opts)
+	defer rdb.Close()
+	users, err := newUserStore(cfg.Users, rdb, secrets, time.Now())
+	if err != nil {
+		return fmt.Errorf("users: %w", err)
+	}
+	deps, err := newDeps(cfg, rdb, secrets, users)
+	if err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	fmt.Fprintln(w, "templates: ok")
+
+	if _, err := loadTemplate(); err != nil {
+		fmt.Fprintf(w, "embedded templates: %v\n", err)
+		failed = append(failed, "embedded templates")
+	} else {
+		fmt.Fprintln(w, "embedded templates: ok")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := deps.Redis.Ping(ctx).Err(); err != nil {
+		fmt.Fprintf(w, "redis %s: %v\n", cfg.Redis.Addr, err)
+		failed = append(failed, "redis")
+	} else {
+		fmt.Fprintf(w, "redis %s: ok\n", cfg.Redis.Addr)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("check failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func encryptSecretCommand(r io.Reader, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("encrypt-secret", flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "base64 key file, GIN_DEMO_SECRETS_KEY when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: gin-demo encrypt-secret [-key-file path] NAME < value")
+	}
+	name := fs.Arg(0)
+
+	key, err := readSecretsKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sealed, err := encryptSecret(key, name, strings.TrimRight(string(value), "\r\n"))
+	if err != nil {
+		return err
+	}
+	// Ready to append to the encrypted secrets file.
+	_, err = fmt.Fprintf(w, "%s: %s\n", name, sealed)
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds everything that differs between a laptop, CI and production.
+// Values are layered: defaults, then the YAML file, then environment
+// variables, then command-line flags.
+type Config struct {
+	// Profile is dev, test or release, see profiles.
+	Profile  string         `yaml:"profile"`
+	Log      LogConfig      `yaml:"log"`
+	Redis    RedisConfig    `yaml:"redis"`
+	Upload   UploadConfig   `yaml:"upload"`
+	Servers  ServersConfig  `yaml:"servers"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Tokens   TokensConfig   `yaml:"tokens"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Users    UsersConfig    `yaml:"users"`
+	Sessions SessionsConfig `yaml:"sessions"`
+	RBAC     RBACConfig     `yaml:"rbac"`
+	Proxy    ProxyConfig    `yaml:"proxy"`
+	Secrets  SecretsConfig  `yaml:"secrets"`
+	Modules  ModulesConfig  `yaml:"modules"`
+	API      APIConfig      `yaml:"api"`
+}
+
+type LogConfig struct {
+	// Level is the lowest level written: debug, info, warn or error.
+	Level Level `yaml:"level"`
+	// ModuleLevels override Level per module, see logModuleNames.
+	ModuleLevels map[string]Level `yaml:"module_levels"`
+	// LevelTTL is how long a level set through /admin/log/level lasts
+	// unless the request says otherwise.
+	LevelTTL time.Duration `yaml:"level_ttl"`
+	// File is where gin.DefaultWriter is copied to. Empty means stdout only.
+	File string `yaml:"file"`
+	// MaxSizeMB rotates the file once it would grow past it, 0 disables.
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// Daily rotates the file on the first write of a new day.
+	Daily bool `yaml:"daily"`
+	// MaxBackups is how many rotated files to keep, 0 keeps all.
+	MaxBackups int `yaml:"max_backups"`
+	// Compress gzips rotated files.
+	Compress bool `yaml:"compress"`
+	// Redact lists values masked in access logs, debug dumps and panic
+	// reports.
+	Redact RedactConfig `yaml:"redact"`
+	// SlowThreshold flags requests taking longer with a warning entry,
+	// 0 disables.
+	SlowThreshold time.Duration `yaml:"slow_threshold"`
+	// Routes override the access log settings per route pattern, e.g.
+	// "/user/:name" or "/assets/*filepath", as listed by the routes command.
+	Routes map[string]RouteLogConfig `yaml:"routes"`
+	// Formats are custom access log formats by name, text/templates over
+	// gin.LogFormatterParams, e.g. "{{.ClientIP}} {{.Method}} {{.Path}}".
+	// The full JSON entry is available as .Entry.
+	Formats map[string]string `yaml:"formats"`
+}
+
+type RouteLogConfig struct {
+	// SlowThreshold replaces log.slow_threshold when set.
+	SlowThreshold time.Duration `yaml:"slow_threshold"`
+	// SampleRate is the fraction of successful requests that are logged,
+	// all when unset. Errors and slow requests are always logged.
+	SampleRate *float64 `yaml:"sample_rate"`
+}
+
+// RedactConfig are denylists of names whose values never reach the logs.
+// Names are matched case-insensitively.
+type RedactConfig struct {
+	Headers []string `yaml:"headers"`
+	// Params are query and form parameters.
+	Params  []string `yaml:"params"`
+	Cookies []string `yaml:"cookies"`
+}
+
+type RedisConfig struct {
+	Addr string `yaml:"addr"`
+	// PasswordSecret names the secret holding the password, if any.
+	PasswordSecret string `yaml:"password_secret"`
+	DB             int    `yaml:"db"`
+}
+
+type UploadConfig struct {
+	Dir        string `yaml:"dir"`
+	ProfileDir string `yaml:"profile_dir"`
+	MaxMemory  int64  `yaml:"max_memory"`
+}
+
+type ServersConfig struct {
+	// ShutdownTimeout bounds the graceful shutdown of all servers.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Main     ServerConfig `yaml:"main"`
+	Server01 ServerConfig `yaml:"server01"`
+	Server02 ServerConfig `yaml:"server02"`
+}
+
+type ServerConfig struct {
+	Addr           string        `yaml:"addr"`
+	ReadTimeout    time.Duration `yaml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes"`
+	// AccessLog names the access log format: json, common, combined,
+	// logfmt or one of log.formats.
+	AccessLog string `yaml:"access_log"`
+}
+
+type APIConfig struct {
+	// DefaultVersion serves /api requests that ask for no version.
+	DefaultVersion int `yaml:"default_version"`
+	// V1Deprecated and V1Sunset are sent as the Deprecation and Sunset
+	// headers of v1 responses, when set.
+	V1Deprecated time.Time `yaml:"v1_deprecated"`
+	V1Sunset     time.Time `yaml:"v1_sunset"`
+}
+
+// TokensConfig sets up the bearer tokens of the authorized routes.
+type TokensConfig struct {
+	// Store is where tokens are looked up: secret or redis.
+	Store string `yaml:"store"`
+	// Secret names the secret holding "token subject scopes [expires_at]"
+	// lines for the secret store.
+	Secret string `yaml:"secret"`
+	// AllowQuery accepts ?token= besides the Authorization header. Tokens
+	// in URLs end up in logs, histories and caches.
+	AllowQuery bool `yaml:"allow_query"`
+}
+
+// JWTConfig sets up the access and refresh tokens the logins issue.
+type JWTConfig struct {
+	// Algorithm signs the access tokens: HS256, RS256 or EdDSA.
+	Algorithm string `yaml:"algorithm"`
+	// KeySecret names the secret holding the HMAC key for HS256, or the
+	// PEM private key for RS256 and EdDSA.
+	KeySecret  string        `yaml:"key_secret"`
+	Issuer     string        `yaml:"issuer"`
+	AccessTTL  time.Duration `yaml:"access_ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+	// Scopes are granted to every login.
+	Scopes []string `yaml:"scopes"`
+}
+
+// UsersConfig sets up the accounts of the login endpoints.
+type UsersConfig struct {
+	// Store is memory or redis. Memory users are lost on restart and on
+	// reloads that change this section.
+	Store string `yaml:"store"`
+	// SeedSecret names the secret with "user:hash" lines the memory store
+	// starts with. It must exist; leave it empty to start without users.
+	SeedSecret string `yaml:"seed_secret"`
+	// Hash is how new passwords are hashed: bcrypt or argon2id. Existing
+	// hashes of either kind keep working.
+	Hash       string `yaml:"hash"`
+	BcryptCost int    `yaml:"bcrypt_cost"`
+}
+
+// SessionsConfig sets up the server-side sessions kept in Redis.
+type SessionsConfig struct {
+	// Cookie names the cookie carrying the signed session ID.
+	Cookie string `yaml:"cookie"`
+	// KeySecret names the secret holding the signing key, at least 32
+	// bytes.
+	KeySecret string `yaml:"key_secret"`
+	// A session ends IdleTTL after its last request, and AbsoluteTTL after
+	// it started whatever happens.
+	IdleTTL     time.Duration `yaml:"idle_ttl"`
+	AbsoluteTTL time.Duration `yaml:"absolute_ttl"`
+	// Secure sends the cookie over HTTPS only.
+	Secure bool `yaml:"secure"`
+}
+
+// RBACConfig is the policy of Require. Roles and subjects in the config
+// file replace the defaults as a whole, so the file lists every grant.
+type RBACConfig struct {
+	// Roles lists the permissions of each role; "*" grants all of them.
+	// Every principal holds the authenticated role.
+	Roles map[string][]string `yaml:"roles"`
+	// Subjects lists the roles of principals by source and subject:
+	// "token:<subject>" for token subjects, "user:<name>" for login users
+	// and "admin:<name>" for admin accounts.
+	Subjects map[string][]string `yaml:"subjects"`
+}
+
+type AdminConfig struct {
+	Realm string `yaml:"realm"`
+	// AccountsSecret names the secret holding htpasswd lines,
+	// "user:hash[:realm]" with bcrypt or {SHA} hashes.
+	AccountsSecret string `yaml:"accounts_secret"`
+	// ReloadInterval is how often the accounts secret is read again.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// After MaxFailures wrong passwords in a row an account is locked for
+	// LockoutDuration. Zero MaxFailures never locks.
+	MaxFailures     int           `yaml:"max_failures"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+}
+
+// ModulesConfig switches the feature modules of the main engine, see Module.
+type ModulesConfig struct {
+	Demo      ModuleConfig `yaml:"demo"`
+	Auth      ModuleConfig `yaml:"auth"`
+	Binding   ModuleConfig `yaml:"binding"`
+	Uploads   ModuleConfig `yaml:"uploads"`
+	Rendering ModuleConfig `yaml:"rendering"`
+	Static    ModuleConfig `yaml:"static"`
+	Templates ModuleConfig `yaml:"templates"`
+	Admin     ModuleConfig `yaml:"admin"`
+	Redis     ModuleConfig `yaml:"redis"`
+	Debug     ModuleConfig `yaml:"debug"`
+	Docs      ModuleConfig `yaml:"docs"`
+}
+
+type ModuleConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Prefix  string `yaml:"prefix"`
+}
+
+func (m *ModulesConfig) byName() map[string]*ModuleConfig {
+	return map[string]*ModuleConfig{
+		"demo":      &m.Demo,
+		"auth":      &m.Auth,
+		"binding":   &m.Binding,
+		"uploads":   &m.Uploads,
+		"rendering": &m.Rendering,
+		"static":    &m.Static,
+		"templates": &m.Templates,
+		"admin":     &m.Admin,
+		"redis":     &m.Redis,
+		"debug":     &m.Debug,
+		"docs":      &m.Docs,
+	}
+}
+
+// get returns the settings of the named module, disabled when unknown.
+func (m *ModulesConfig) get(name string) ModuleConfig {
+	if mc, ok := m.byName()[name]; ok {
+		return *mc
+	}
+	return ModuleConfig{}
+}
+
+type SecretsConfig struct {
+	// Providers are asked in order: file, env and encrypted.
+	Providers []string `yaml:"providers"`
+	// Dir holds one file per secret, e.g. /run/secrets.
+	Dir string `yaml:"dir"`
+	// EnvPrefix is prepended to the upper-cased secret name.
+	EnvPrefix string `yaml:"env_prefix"`
+	// File is the encrypted secrets file, KeyFile its base64 key.
+	// Without KeyFile the key is read from GIN_DEMO_SECRETS_KEY.
+	File    string `yaml:"file"`
+	KeyFile string `yaml:"key_file"`
+}
+
+type ProxyConfig struct {
+	// TrustedProxies are IPs or CIDRs allowed to set the client IP headers.
+	TrustedProxies  []string `yaml:"trusted_proxies"`
+	TrustedPlatform string   `yaml:"trusted_platform"`
+}
+
+// DefaultConfig returns the settings used when nothing overrides them.
+func DefaultConfig() *Config {
+	return &Config{
+		Profile: "dev",
+		Log: LogConfig{
+			Level:      LevelInfo,
+			LevelTTL:   15 * time.Minute,
+			File:       "logs/gin.log",
+			MaxSizeMB:  100,
+			Daily:      true,
+			MaxBackups: 14,
+			Compress:   true,
+			Redact: RedactConfig{
+				Headers: []string{"Authorization", "Proxy-Authorization", "X-Api-Key"},
+				Params:  []string{"password", "token", "access_token", "refresh_token"},
+				Cookies: []string{"gin_cookie", "session"},
+			},
+			SlowThreshold: time.Second,
+			Routes: map[string]RouteLogConfig{
+				"/ping":             {SampleRate: sampleRate(0.01)},
+				"/assets/*filepath": {SampleRate: sampleRate(0.1)},
+				"/long_sync":        {SlowThreshold: 5 * time.Second},
+			},
+		},
+		Redis: RedisConfig{
+			Addr:           "127.0.0.1:6379",
+			PasswordSecret: "redis_password",
+		},
+		Upload: UploadConfig{
+			Dir:        "uploads",
+			ProfileDir: "uploads/profiles",
+			MaxMemory:  8 << 20, // 8M (default is 32M)
+		},
+		Servers: ServersConfig{
+			ShutdownTimeout: 5 * time.Second,
+			Main: ServerConfig{
+				Addr:           ":8080",
+				ReadTimeout:    10 * time.Second,
+				WriteTimeout:   10 * time.Second,
+				MaxHeaderBytes: 1 << 20,
+				AccessLog:      "json",
+			},
+			Server01: ServerConfig{
+				Addr:         ":8081",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				AccessLog:    "json",
+			},
+			Server02: ServerConfig{
+				Addr:         ":8082",
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				AccessLog:    "json",
+			},
+		},
+		Admin: AdminConfig{
+			AccountsSecret:  "admin_accounts",
+			ReloadInterval:  10 * time.Second,
+			MaxFailures:     5,
+			LockoutDuration: 15 * time.Minute,
+		},
+		Tokens: TokensConfig{
+			Store:  "secret",
+			Secret: "api_tokens",
+		},
+		JWT: JWTConfig{
+			Algorithm:  "HS256",
+			KeySecret:  "jwt_key",
+			Issuer:     "gin-demo",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+			Scopes:     []string{"ping", "logout", "messages:read", "messages:write"},
+		},
+		Users: UsersConfig{
+			Store:      "memory",
+			SeedSecret: "users",
+			Hash:       "bcrypt",
+			BcryptCost: 10,
+		},
+		RBAC: RBACConfig{
+			Roles: map[string][]string{
+				authenticatedRole: {"ping", "logout"},
+				"reader":          {"messages:read"},
+				"writer":          {"messages:read", "messages:write"},
+				"analyst":         {"analytics:read"},
+				"operator":        {"admin:secrets", "admin:log:read", "admin:log:write", "admin:routes"},
+			},
+			Subjects: map[string][]string{
+				"token:demo":   {"writer", "analyst"},
+				"token:reader": {"reader"},
+			},
+		},
+		Sessions: SessionsConfig{
+			Cookie:      "session",
+			KeySecret:   "session_key",
+			IdleTTL:     30 * time.Minute,
+			AbsoluteTTL: 24 * time.Hour,
+		},
+		API: APIConfig{
+			DefaultVersion: 2,
+			V1Deprecated:   time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+			V1Sunset:       time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Modules: ModulesConfig{
+			Demo:      ModuleConfig{Enabled: true, Prefix: "/"},
+			Auth:      ModuleConfig{Enabled: true, Prefix: "/"},
+			Binding:   ModuleConfig{Enabled: true, Prefix: "/"},
+			Uploads:   ModuleConfig{Enabled: true, Prefix: "/"},
+			Rendering: ModuleConfig{Enabled: true, Prefix: "/"},
+			Static:    ModuleConfig{Enabled: true, Prefix: "/"},
+			Templates: ModuleConfig{Enabled: true, Prefix: "/"},
+			Admin:     ModuleConfig{Enabled: true, Prefix: "/admin"},
+			Redis:     ModuleConfig{Enabled: true, Prefix: "/"},
+			Debug:     ModuleConfig{Enabled: true, Prefix: "/debug"},
+			Docs:      ModuleConfig{Enabled: true, Prefix: "/"},
+		},
+		Secrets: SecretsConfig{
+			Providers: []string{"file", "env"},
+			Dir:       "/run/secrets",
+			EnvPrefix: "GIN_DEMO_SECRET_",
+		},
+		Proxy: ProxyConfig{
+			// Gin trusts every proxy unless told otherwise.
+			TrustedProxies:  []string{"0.0.0.0/0", "::/0"},
+			TrustedPlatform: "X-CDN-IP",
+		},
+	}
+}
+
+func sampleRate(r float64) *float64 { return &r }
+
+// configEnv maps environment variables to the flag they override.
+var configEnv = map[string]string{
+	"GIN_DEMO_PROFILE":     "profile",
+	"GIN_DEMO_LOG_FILE":    "log-file",
+	"GIN_DEMO_REDIS_ADDR":  "redis-addr",
+	"GIN_DEMO_REDIS_DB":    "redis-db",
+	"GIN_DEMO_UPLOAD_DIR":  "upload-dir",
+	"GIN_DEMO_PROFILE_DIR": "profile-dir",
+	"GIN_DEMO_ADDR":        "addr",
+	"GIN_DEMO_ADDR_01":     "addr-01",
+	"GIN_DEMO_ADDR_02":     "addr-02",
+	"GIN_DEMO_SECRETS_DIR": "secrets-dir",
+}
+
+// bindConfigFlags registers the overridable settings of c on fs.
+// Secrets are deliberately not flags, they would show up in ps.
+func bindConfigFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Profile, "profile", c.Profile, "run-mode profile: dev, test or release")
+	fs.StringVar(&c.Log.File, "log-file", c.Log.File, "log file path, empty for stdout only")
+	fs.StringVar(&c.Redis.Addr, "redis-addr", c.Redis.Addr, "Redis server address")
+	fs.IntVar(&c.Redis.DB, "redis-db", c.Redis.DB, "Redis database number")
+	fs.StringVar(&c.Upload.Dir, "upload-dir", c.Upload.Dir, "directory for uploaded files")
+	fs.StringVar(&c.Upload.ProfileDir, "profile-dir", c.Upload.ProfileDir, "directory for profile avatars")
+	fs.StringVar(&c.Servers.Main.Addr, "addr", c.Servers.Main.Addr, "listen address of the main server")
+	fs.StringVar(&c.Servers.Server01.Addr, "addr-01", c.Servers.Server01.Addr, "listen address of server 01")
+	fs.StringVar(&c.Servers.Server02.Addr, "addr-02", c.Servers.Server02.Addr, "listen address of server 02")
+	fs.StringVar(&c.Secrets.Dir, "secrets-dir", c.Secrets.Dir, "directory of the file secrets provider")
+}
+
+// LoadConfig parses args with fs and builds the layered Config.
+// Callers may register their own flags on fs beforehand.
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", "", "path to the YAML config file (env GIN_DEMO_CONFIG)")
+	bindConfigFlags(fs, DefaultConfig())
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Remember what was given on the command line so it can be applied last.
+	cmdline := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		cmdline[f.Name] = f.Value.String()
+	})
+
+	if *path == "" {
+		*path = os.Getenv("GIN_DEMO_CONFIG")
+	}
+
+	cfg := DefaultConfig()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	apply := flag.NewFlagSet("", flag.ContinueOnError)
+	bindConfigFlags(apply, cfg)
+	for env, name := range configEnv {
+		if v, ok := os.LookupEnv(env); ok {
+			if err := apply.Set(name, v); err != nil {
+				return nil, fmt.Errorf("config: env %s: %w", env, err)
+			}
+		}
+	}
+	for name, v := range cmdline {
+		if apply.Lookup(name) == nil {
+			continue
+		}
+		if err := apply.Set(name, v); err != nil {
+			return nil, fmt.Errorf("config: flag -%s: %w", name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	// yaml.v3 merges maps into the defaults, which would leave a default
+	// grant the file takes away. The rbac maps of a file replace them.
+	roles, subjects := c.RBAC.Roles, c.RBAC.Subjects
+	c.RBAC.Roles, c.RBAC.Subjects = nil, nil
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	if c.RBAC.Roles == nil {
+		c.RBAC.Roles = roles
+	}
+	if c.RBAC.Subjects == nil {
+		c.RBAC.Subjects = subjects
+	}
+	return nil
+}
+
+// ConfigError lists every problem found by Validate.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate reports all invalid settings at once.
+func (c *Config) Validate() error {
+	var problems ConfigError
+
+	if _, ok := profiles[c.Profile]; !ok {
+		problems = append(problems, fmt.Sprintf("profile %q must be dev, test or release", c.Profile))
+	}
+
+	if c.Log.MaxSizeMB < 0 {
+		problems = append(problems, "log.max_size_mb must not be negative")
+	}
+	if c.Log.MaxBackups < 0 {
+		problems = append(problems, "log.max_backups must not be negative")
+	}
+	if c.Log.LevelTTL <= 0 {
+		problems = append(problems, "log.level_ttl must be positive")
+	}
+	known := map[string]bool{}
+	for _, name := range logModuleNames(c) {
+		known[name] = true
+	}
+	levelModules := make([]string, 0, len(c.Log.ModuleLevels))
+	for name := range c.Log.ModuleLevels {
+		levelModules = append(levelModules, name)
+	}
+	sort.Strings(levelModules)
+	for _, name := range levelModules {
+		if !known[name] {
+			problems = append(problems, fmt.Sprintf("log.module_levels: unknown module %q", name))
+		}
+	}
+	if c.Log.SlowThreshold < 0 {
+		problems = append(problems, "log.slow_threshold must not be negative")
+	}
+	routes := make([]string, 0, len(c.Log.Routes))
+	for route := range c.Log.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		rc := c.Log.Routes[route]
+		if !strings.HasPrefix(route, "/") {
+			problems = append(problems, fmt.Sprintf("log.routes: %q must start with /", route))
+		}
+		if rc.SlowThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("log.routes.%s.slow_threshold must not be negative", route))
+		}
+		if rc.SampleRate != nil && (*rc.SampleRate < 0 || *rc.SampleRate > 1) {
+			problems = append(problems, fmt.Sprintf("log.routes.%s.sample_rate must be between 0 and 1", route))
+		}
+	}
+	if c.Redis.Addr == "" {
+		problems = append(problems, "redis.addr must be set")
+	} else if _, _, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("redis.addr %q: %v", c.Redis.Addr, err))
+	}
+	if c.Redis.DB < 0 {
+		problems = append(problems, "redis.db must not be negative")
+	}
+	if c.Upload.Dir == "" {
+		problems = append(problems, "upload.dir must be set")
+	}
+	if c.Upload.ProfileDir == "" {
+		problems = append(problems, "upload.profile_dir must be set")
+	}
+	if c.Upload.MaxMemory <= 0 {
+		problems = append(problems, "upload.max_memory must be positive")
+	}
+
+	if c.Servers.ShutdownTimeout <= 0 {
+		problems = append(problems, "servers.shutdown_timeout must be positive")
+	}
+
+	formats := map[string]bool{}
+	for _, name := range accessLogFormatNames(c.Log) {
+		formats[name] = true
+		_, builtin := accessLogFormats[name]
+		_, custom := c.Log.Formats[name]
+		if builtin && custom {
+			problems = append(problems, fmt.Sprintf("log.formats.%s: replaces a built-in format", name))
+		} else if custom {
+			if _, err := lookupAccessLogFormat(c.Log, name); err != nil {
+				problems = append(problems, fmt.Sprintf("log.formats.%s: %v", name, err))
+			}
+		}
+	}
+
+	seen := map[string]string{}
+	for _, s := range []struct {
+		name string
+		cfg  ServerConfig
+	}{
+		{"servers.main", c.Servers.Main},
+		{"servers.server01", c.Servers.Server01},
+		{"servers.server02", c.Servers.Server02},
+	} {
+		if _, _, err := net.SplitHostPort(s.cfg.Addr); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.addr %q: %v", s.name, s.cfg.Addr, err))
+		} else if other, ok := seen[s.cfg.Addr]; ok {
+			problems = append(problems, fmt.Sprintf("%s.addr %q is already used by %s", s.name, s.cfg.Addr, other))
+		} else {
+			seen[s.cfg.Addr] = s.name
+		}
+		if s.cfg.ReadTimeout <= 0 {
+			problems = append(problems, s.name+".read_timeout must be positive")
+		}
+		if s.cfg.WriteTimeout <= 0 {
+			problems = append(problems, s.name+".write_timeout must be positive")
+		}
+		if s.cfg.MaxHeaderBytes < 0 {
+			problems = append(problems, s.name+".max_header_bytes must not be negative")
+		}
+		if s.cfg.AccessLog != "" && !formats[s.cfg.AccessLog] {
+			problems = append(problems, fmt.Sprintf("%s.access_log: unknown format %q", s.name, s.cfg.AccessLog))
+		}
+	}
+
+	for _, p := range c.Proxy.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			problems = append(problems, fmt.Sprintf("proxy.trusted_proxies: %q is neither an IP nor a CIDR", p))
+		}
+	}
+	modules := c.Modules.byName()
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if m := modules[name]; m.Enabled && !strings.HasPrefix(m.Prefix, "/") {
+			problems = append(problems, fmt.Sprintf("modules.%s.prefix %q must start with /", name, m.Prefix))
+		}
+	}
+	if c.Tokens.Store != "secret" && c.Tokens.Store != "redis" {
+		problems = append(problems, fmt.Sprintf("tokens.store %q must be secret or redis", c.Tokens.Store))
+	}
+	switch c.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		problems = append(problems, fmt.Sprintf("jwt.algorithm %q must be HS256, RS256 or EdDSA", c.JWT.Algorithm))
+	}
+	if c.JWT.AccessTTL <= 0 || c.JWT.RefreshTTL <= c.JWT.AccessTTL {
+		problems = append(problems, "jwt.access_ttl must be positive and below jwt.refresh_ttl")
+	}
+	if c.Users.Store != "memory" && c.Users.Store != "redis" {
+		problems = append(problems, fmt.Sprintf("users.store %q must be memory or redis", c.Users.Store))
+	}
+	if c.Users.Hash != "bcrypt" && c.Users.Hash != "argon2id" {
+		problems = append(problems, fmt.Sprintf("users.hash %q must be bcrypt or argon2id", c.Users.Hash))
+	}
+	if c.Users.Hash == "bcrypt" && (c.Users.BcryptCost < 10 || c.Users.BcryptCost > 31) {
+		problems = append(problems, "users.bcrypt_cost must be between 10 and 31")
+	}
+	if c.Admin.MaxFailures < 0 || (c.Admin.MaxFailures > 0 && c.Admin.LockoutDuration <= 0) {
+		problems = append(problems, "admin.max_failures must not be negative, and admin.lockout_duration positive with it")
+	}
+	subjects := make([]string, 0, len(c.RBAC.Subjects))
+	for subject := range c.RBAC.Subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		if source, name, _ := strings.Cut(subject, ":"); name == "" || !principalSources[source] {
+			problems = append(problems, fmt.Sprintf("rbac.subjects.%s: want token:, user: or admin: and a name", subject))
+		}
+		for _, role := range c.RBAC.Subjects[subject] {
+			if _, ok := c.RBAC.Roles[role]; !ok {
+				problems = append(problems, fmt.Sprintf("rbac.subjects.%s: unknown role %q", subject, role))
+			}
+		}
+	}
+	if c.Sessions.Cookie == "" {
+		problems = append(problems, "sessions.cookie must be set")
+	}
+	if c.Sessions.IdleTTL <= 0 || c.Sessions.AbsoluteTTL < c.Sessions.IdleTTL {
+		problems = append(problems, "sessions.idle_ttl must be positive and at most sessions.absolute_ttl")
+	}
+	if !supportedVersion(c.API.DefaultVersion) {
+		problems = append(problems, fmt.Sprintf("api.default_version must be between 1 and %d", latestVersion))
+	}
+	if !c.API.V1Sunset.IsZero() && c.API.V1Sunset.Before(c.API.V1Deprecated) {
+		problems = append(problems, "api.v1_sunset must not be before api.v1_deprecated")
+	}
+	for _, p := range c.Secrets.Providers {
+		switch p {
+		case "file", "env":
+		case "encrypted":
+			if c.Secrets.File == "" {
+				problems = append(problems, "secrets.file must be set for the encrypted provider")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("secrets.providers: unknown provider %q", p))
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("redis:\n  addr: redis:6379\nservers:\n  main:\n    addr: :9090\n    read_timeout: 3s\n"), 0o600)
+	assert.NoError(t, err)
+
+	t.Setenv("GIN_DEMO_REDIS_ADDR", "env-redis:6379")
+	t.Setenv("GIN_DEMO_ADDR", ":9191")
+
+	cfg, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path, "-addr", ":9292"})
+	assert.NoError(t, err)
+	assert.Equal(t, "env-redis:6379", cfg.Redis.Addr)
+	assert.Equal(t, ":9292", cfg.Servers.Main.Addr)
+	assert.Equal(t, 3*time.Second, cfg.Servers.Main.ReadTimeout)
+	assert.Equal(t, ":8081", cfg.Servers.Server01.Addr)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Redis.Addr = "no-port"
+	cfg.Servers.Server02.Addr = cfg.Servers.Main.Addr
+	cfg.Servers.Server01.ReadTimeout = 0
+	cfg.Log.Routes["/ping"] = RouteLogConfig{SampleRate: sampleRate(2)}
+	err := cfg.Validate()
+	assert.IsType(t, ConfigError{}, err)
+	assert.Len(t, err.(ConfigError), 4)
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("redis:\n  adress: x\n"), 0o600))
+
+	_, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	assert.Error(t, err)
+}
+
+func TestLoadConfigRBACReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("rbac:\n  subjects:\n    \"token:demo\": [reader]\n"), 0o600))
+
+	cfg, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"token:demo": {"reader"}}, cfg.RBAC.Subjects)
+	assert.Equal(t, DefaultConfig().RBAC.Roles, cfg.RBAC.Roles, "roles the file leaves out keep the defaults")
+}
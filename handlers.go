@@ -13,23 +13,25 @@ func checkboxGetHandler(c *gin.Context) {
 func checkboxPostHandler(c *gin.Context) {
 	var checkboxForm checkboxForm
 	if err := c.Bind(&checkboxForm); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		c.String(http.StatusBadRequest, bindError(err))
 	} else {
 		c.JSON(http.StatusOK, gin.H{"color": checkboxForm.Colors})
 	}
 }
 
-func profileHandler(c *gin.Context) {
-	var profileForm profileForm
-	if err := c.ShouldBind(&profileForm); err != nil {
-		// if err := c.ShouldBindWith(&profileForm, binding.Form); err != nil {
-		c.String(http.StatusBadRequest, "bind error", err.Error())
-	} else {
-		err := c.SaveUploadedFile(profileForm.Avatar, "/Users/kopever/Develop/temp/gin-demo/"+profileForm.Name)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "save error", err.Error())
+func profileHandler(store Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var profileForm profileForm
+		if err := c.ShouldBind(&profileForm); err != nil {
+			// if err := c.ShouldBindWith(&profileForm, binding.Form); err != nil {
+			c.String(http.StatusBadRequest, "bind error: %s", bindError(err))
 		} else {
-			c.String(http.StatusOK, "ok")
+			err := store.Save(profileForm.Avatar, profileForm.Name)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "save error", err.Error())
+			} else {
+				c.String(http.StatusOK, "ok")
+			}
 		}
 	}
 }
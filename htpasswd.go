@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdAccount is a line of an htpasswd file.
+type htpasswdAccount struct {
+	// hash is a bcrypt hash or {SHA} with the base64 SHA-1 of the password.
+	hash string
+	// realm limits the account to the group of that realm when set.
+	realm string
+}
+
+// parseHtpasswd reads "user:hash[:realm]" lines as written by htpasswd -B
+// or -s. Blank lines and lines starting with # are skipped.
+func parseHtpasswd(s Secret) (map[string]htpasswdAccount, error) {
+	accounts := map[string]htpasswdAccount{}
+	sc := bufio.NewScanner(strings.NewReader(s.Reveal()))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		// Never echo the line, it may hold a plaintext password.
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("htpasswd line %d: want user:hash[:realm]", n)
+		}
+		if !strings.HasPrefix(fields[1], "$2") && !strings.HasPrefix(fields[1], "{SHA}") {
+			return nil, fmt.Errorf("htpasswd line %d: only bcrypt and {SHA} hashes are supported", n)
+		}
+		account := htpasswdAccount{hash: fields[1]}
+		if len(fields) == 3 {
+			account.realm = fields[2]
+		}
+		accounts[fields[0]] = account
+	}
+	return accounts, sc.Err()
+}
+
+// matches compares password with the hash of a in constant time.
+func (a htpasswdAccount) matches(password string) bool {
+	if strings.HasPrefix(a.hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		want := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(want), []byte(a.hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(a.hash), []byte(password)) == nil
+}
+
+var errAccountLocked = errors.New("account locked")
+
+// maxTrackedGuesses bounds the lockout state of names without an account,
+// which attackers can grow by guessing names.
+const maxTrackedGuesses = 10000
+
+// loginFailures counts the wrong passwords in a row of a user name.
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// lockouts holds the admin login failures. It lives in Deps.Lockouts and
+// outlives reloads, so a SIGHUP unlocks nobody. Names with an account are
+// always tracked; other names lock too, so lockouts don't tell which names
+// exist, but at most maxTrackedGuesses of them, dropping the oldest.
+type lockouts struct {
+	mu      sync.Mutex
+	known   map[string]*loginFailures
+	guesses map[string]*loginFailures
+}
+
+func newLockouts() *lockouts {
+	return &lockouts{known: map[string]*loginFailures{}, guesses: map[string]*loginFailures{}}
+}
+
+// get returns the failures of user, or nil. The caller holds l.mu.
+func (l *lockouts) get(user string) *loginFailures {
+	if f := l.known[user]; f != nil {
+		return f
+	}
+	return l.guesses[user]
+}
+
+// lockedUntil returns the end of user's lockout, zero when never locked.
+func (l *lockouts) lockedUntil(user string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f := l.get(user); f != nil {
+		return f.lockedUntil
+	}
+	return time.Time{}
+}
+
+func (l *lockouts) reset(user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.known, user)
+	delete(l.guesses, user)
+}
+
+// fail counts a wrong password for user and locks it after cfg.MaxFailures
+// in a row. It returns the end of a lockout it started, zero otherwise.
+func (l *lockouts) fail(user string, known bool, now time.Time, cfg AdminConfig) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f := l.get(user)
+	if f == nil {
+		f = &loginFailures{}
+		if known {
+			l.known[user] = f
+		} else {
+			l.makeRoom(now, cfg.LockoutDuration)
+			l.guesses[user] = f
+		}
+	}
+	f.count++
+	f.last = now
+	if cfg.MaxFailures > 0 && f.count >= cfg.MaxFailures {
+		f.count, f.lockedUntil = 0, now.Add(cfg.LockoutDuration)
+		return f.lockedUntil
+	}
+	return time.Time{}
+}
+
+// makeRoom drops stale guesses once there are maxTrackedGuesses, and the
+// oldest one if none is stale. The caller holds l.mu.
+func (l *lockouts) makeRoom(now time.Time, lockout time.Duration) {
+	if len(l.guesses) < maxTrackedGuesses {
+		return
+	}
+	oldest := ""
+	for name, f := range l.guesses {
+		if now.Sub(f.last) >= lockout && !now.Before(f.lockedUntil) {
+			delete(l.guesses, name)
+		} else if oldest == "" || f.last.Before(l.guesses[oldest].last) {
+			oldest = name
+		}
+	}
+	if len(l.guesses) >= maxTrackedGuesses {
+		delete(l.guesses, oldest)
+	}
+}
+
+// adminAccounts checks the admin group's BasicAuth credentials against the
+// htpasswd lines of admin.accounts_secret. The secret is read again at most
+// every admin.reload_interval, so rotated accounts work without a restart.
+type adminAccounts struct {
+	cfg      AdminConfig
+	secrets  SecretProvider
+	clock    func() time.Time
+	logger   *Logger
+	lockouts *lockouts
+
+	mu       sync.Mutex
+	accounts map[string]htpasswdAccount
+	loaded   Secret
+	loadedAt time.Time
+	dummy    htpasswdAccount
+}
+
+// newAdminAccounts counts failures in deps.Lockouts, or in a table of its
+// own when that is nil.
+func newAdminAccounts(deps Deps) *adminAccounts {
+	a := &adminAccounts{
+		cfg:      deps.Config.Admin,
+		secrets:  deps.Secrets,
+		clock:    deps.Clock,
+		logger:   deps.logger("router"),
+		lockouts: deps.Lockouts,
+	}
+	if a.lockouts == nil {
+		a.lockouts = newLockouts()
+	}
+	a.reload(a.clock())
+	return a
+}
+
+// reload re-reads the secret, keeping the accounts it had when that fails.
+func (a *adminAccounts) reload(now time.Time) {
+	a.loadedAt = now
+	secret, err := a.secrets.Secret(a.cfg.AccountsSecret)
+	if err == nil && a.accounts != nil && secret == a.loaded {
+		return
+	}
+	var accounts map[string]htpasswdAccount
+	if err == nil {
+		accounts, err = parseHtpasswd(secret)
+	}
+	if err == nil && len(accounts) == 0 {
+		err = errors.New("no accounts")
+	}
+	if err != nil {
+		if a.accounts == nil {
+			a.logger.Warnf("admin accounts: %v, /admin is disabled", err)
+		} else {
+			a.logger.Errorf("admin accounts: %v, keeping the accounts loaded before", err)
+		}
+		return
+	}
+	a.accounts, a.loaded = accounts, secret
+}
+
+// Check returns errInvalidLogin unless user has password and belongs to
+// realm, and errAccountLocked while user is locked out. Unknown users are
+// locked out like known ones, so lockouts don't tell which names exist.
+func (a *adminAccounts) Check(user, password, realm string) error {
+	a.mu.Lock()
+	now := a.clock()
+	if now.Sub(a.loadedAt) >= a.cfg.ReloadInterval {
+		a.reload(now)
+	}
+	if now.Before(a.lockouts.lockedUntil(user)) {
+		a.mu.Unlock()
+		return errAccountLocked
+	}
+	account, ok := a.accounts[user]
+	if !ok {
+		if a.dummy.hash == "" {
+			hash, _ := bcrypt.GenerateFromPassword([]byte(randomToken(16)), bcrypt.DefaultCost)
+			a.dummy.hash = string(hash)
+		}
+		account = a.dummy
+	}
+	a.mu.Unlock()
+
+	// Hash outside the lock, bcrypt is slow on purpose.
+	if account.matches(password) && ok && (account.realm == "" || account.realm == realm) {
+		a.lockouts.reset(user)
+		return nil
+	}
+	if until := a.lockouts.fail(user, ok, now, a.cfg); !until.IsZero() {
+		a.logger.Warnf("admin account %q locked until %s", user, until.Format(time.RFC3339))
+	}
+	return errInvalidLogin
+}
+
+// lockedFor returns how long user stays locked out.
+func (a *adminAccounts) lockedFor(user string) time.Duration {
+	return a.lockouts.lockedUntil(user).Sub(a.clock())
+}
+
+// adminAuth guards the /admin group with BasicAuth against adminAccounts.
+// Like gin.BasicAuthForRealm it sets gin.AuthUserKey, and it stores the
+// Principal with its roles; locked accounts get 429 with Retry-After.
+func adminAuth(deps Deps) gin.HandlerFunc {
+	accounts := newAdminAccounts(deps)
+	policy := newRBACPolicy(deps.Config.RBAC)
+	realm := deps.Config.Admin.Realm
+	challenge := "Authorization Required"
+	if realm != "" {
+		challenge = realm
+	}
+	challenge = "Basic realm=" + strconv.Quote(challenge)
+
+	return requiresAuth("basic", func(c *gin.Context) {
+		user, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		switch err := accounts.Check(user, password, realm); {
+		case errors.Is(err, errAccountLocked):
+			c.Header("Retry-After", strconv.Itoa(int(accounts.lockedFor(user).Round(time.Second)/time.Second)))
+			abortProblem(c, newProblem(c, http.StatusTooManyRequests, "Too many wrong passwords, try again later."))
+			return
+		case err != nil:
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if authorize(c, policy, Principal{Source: sourceAdmin, Subject: user}) {
+			c.Next()
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHtpasswd(t *testing.T) {
+	accounts, err := parseHtpasswd("# comment\nfoo:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\n\nmanu:$2a$04$MQiD7RxlpnpTE0MrFZHSiOPSD7WND3cB4dJLf3ydDdu06LXK4RheO:ops\n")
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.True(t, accounts["foo"].matches("bar"))
+	assert.False(t, accounts["foo"].matches("baz"))
+	assert.True(t, accounts["manu"].matches("123"))
+	assert.Equal(t, "ops", accounts["manu"].realm)
+
+	_, err = parseHtpasswd("foo:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\nfoo:hunter2\n")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2")
+	_, err = parseHtpasswd("hunter2\n")
+	assert.Error(t, err)
+}
+
+func TestAdminLockout(t *testing.T) {
+	deps := testDeps()
+	now := deps.Clock()
+	deps.Clock = func() time.Time { return now }
+	router := NewRouter(deps)
+	status := func(user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/secrets", nil)
+		req.SetBasicAuth(user, password)
+		return perform(router, req)
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, status("foo", "wrong").Code)
+	}
+	w := status("foo", "bar")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "900", w.Header().Get("Retry-After"))
+	// /debug shares the table of /admin.
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	req.SetBasicAuth("foo", "bar")
+	assert.Equal(t, http.StatusTooManyRequests, perform(router, req).Code)
+	assert.Equal(t, http.StatusOK, status("austin", "1234").Code)
+
+	now = now.Add(15 * time.Minute)
+	assert.Equal(t, http.StatusOK, status("foo", "bar").Code)
+
+	// Unknown names lock like known ones.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, status("nobody", "x").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status("nobody", "x").Code)
+}
+
+func TestAdminLockoutSpray(t *testing.T) {
+	deps := testDeps()
+	accounts := newAdminAccounts(deps)
+	now := deps.Clock()
+
+	// Guessed names can't crowd out the accounts, nor grow without bound.
+	for i := 0; i <= maxTrackedGuesses; i++ {
+		accounts.lockouts.fail(fmt.Sprintf("junk%d", i), false, now.Add(time.Duration(i)), deps.Config.Admin)
+	}
+	assert.Len(t, accounts.lockouts.guesses, maxTrackedGuesses)
+	assert.NotContains(t, accounts.lockouts.guesses, "junk0")
+	for i := 0; i < 5; i++ {
+		assert.ErrorIs(t, accounts.Check("foo", "wrong", ""), errInvalidLogin)
+	}
+	assert.ErrorIs(t, accounts.Check("foo", "bar", ""), errAccountLocked)
+}
+
+func TestAdminAccountsReload(t *testing.T) {
+	deps := testDeps()
+	now := deps.Clock()
+	deps.Clock = func() time.Time { return now }
+	secrets := mapSecrets{"admin_accounts": "foo:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00="}
+	deps.Secrets = secrets
+	accounts := newAdminAccounts(deps)
+
+	assert.NoError(t, accounts.Check("foo", "bar", ""))
+	secrets["admin_accounts"] = "foo:{SHA}tj9vGhn7EbdIiWOsEW4MX0OI6Fs="
+	assert.NoError(t, accounts.Check("foo", "bar", ""), "read again after reload_interval only")
+	now = now.Add(10 * time.Second)
+	assert.ErrorIs(t, accounts.Check("foo", "bar", ""), errInvalidLogin)
+	assert.NoError(t, accounts.Check("foo", "rotated", ""))
+
+	// A broken secret keeps the accounts loaded before.
+	secrets["admin_accounts"] = "foo:rotated"
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, accounts.Check("foo", "rotated", ""))
+
+	// Accounts with a realm only work in that realm.
+	secrets["admin_accounts"] = "foo:{SHA}tj9vGhn7EbdIiWOsEW4MX0OI6Fs=:ops"
+	now = now.Add(10 * time.Second)
+	assert.ErrorIs(t, accounts.Check("foo", "rotated", ""), errInvalidLogin)
+	assert.NoError(t, accounts.Check("foo", "rotated", "ops"))
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Every login starts a session. Its access tokens are JWTs carrying the
+// session as sid; its refresh tokens are random values kept in Redis, each
+// good for one refresh. Logging out, or reusing a refresh token, revokes
+// the session and with it every token issued to it. Changing a password
+// revokes the other sessions of the user.
+const (
+	refreshKeyPrefix = "gin-demo:jwt:refresh:"
+	// usedKeyPrefix marks the refresh tokens that were already exchanged.
+	usedKeyPrefix    = "gin-demo:jwt:used:"
+	revokedKeyPrefix = "gin-demo:jwt:revoked:"
+	// sessionsKeyPrefix is the set of sessions of a subject.
+	sessionsKeyPrefix = "gin-demo:jwt:sessions:"
+)
+
+// jwtIssuer issues and checks the tokens of logins. It is a TokenStore for
+// its own access tokens.
+type jwtIssuer struct {
+	cfg       JWTConfig
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	redis     redis.Cmdable
+	clock     func() time.Time
+}
+
+// accessClaims are the claims of an access token. Scope is space separated
+// as in RFC 8693.
+type accessClaims struct {
+	Scope   string `json:"scope,omitempty"`
+	Session string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// refreshRecord is what Redis keeps about a refresh token.
+type refreshRecord struct {
+	Subject   string    `json:"subject"`
+	Scopes    []string  `json:"scopes"`
+	Session   string    `json:"session"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenPair is the OAuth 2 style answer of logins and refreshes.
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newJWTIssuer loads the signing key of jwt.key_secret.
+func newJWTIssuer(deps Deps) (*jwtIssuer, error) {
+	cfg := deps.Config.JWT
+	secret, err := deps.Secrets.Secret(cfg.KeySecret)
+	if err != nil {
+		return nil, err
+	}
+	j := &jwtIssuer{cfg: cfg, redis: deps.Redis, clock: deps.Clock}
+	key := []byte(secret.Reveal())
+	switch cfg.Algorithm {
+	case "HS256":
+		if len(key) < 32 {
+			return nil, errors.New("the HS256 key must be at least 32 bytes")
+		}
+		j.method, j.signKey, j.verifyKey = jwt.SigningMethodHS256, key, key
+	case "RS256":
+		k, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+		if err != nil {
+			return nil, err
+		}
+		j.method, j.signKey, j.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case "EdDSA":
+		k, err := jwt.ParseEdPrivateKeyFromPEM(key)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("the EdDSA key is not an Ed25519 key")
+		}
+		j.method, j.signKey, j.verifyKey = jwt.SigningMethodEdDSA, priv, priv.Public()
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q", cfg.Algorithm)
+	}
+	return j, nil
+}
+
+// randomToken returns n random bytes, hex encoded.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Login starts a session for subject with the configured scopes.
+func (j *jwtIssuer) Login(ctx context.Context, subject string) (tokenPair, error) {
+	session := randomToken(16)
+	key := sessionsKeyPrefix + subject
+	if err := j.redis.SAdd(ctx, key, session).Err(); err != nil {
+		return tokenPair{}, err
+	}
+	if err := j.redis.Expire(ctx, key, j.cfg.RefreshTTL).Err(); err != nil {
+		return tokenPair{}, err
+	}
+	return j.issue(ctx, refreshRecord{Subject: subject, Scopes: j.cfg.Scopes, Session: session})
+}
+
+// issue signs an access token and stores a refresh token for the session
+// of rec.
+func (j *jwtIssuer) issue(ctx context.Context, rec refreshRecord) (tokenPair, error) {
+	now := j.clock()
+	claims := accessClaims{
+		Scope:   strings.Join(rec.Scopes, " "),
+		Session: rec.Session,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.cfg.Issuer,
+			Subject:   rec.Subject,
+			ID:        randomToken(16),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.cfg.AccessTTL)),
+		},
+	}
+	access, err := jwt.NewWithClaims(j.method, claims).SignedString(j.signKey)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refresh := randomToken(32)
+	rec.ExpiresAt = now.Add(j.cfg.RefreshTTL)
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err := j.redis.Set(ctx, refreshKeyPrefix+hashToken(refresh), b, j.cfg.RefreshTTL).Err(); err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.cfg.AccessTTL / time.Second),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair of the same session.
+// A refresh token that was exchanged before was stolen or replayed, so
+// its session is revoked.
+func (j *jwtIssuer) Refresh(ctx context.Context, refresh string) (tokenPair, error) {
+	hash := hashToken(refresh)
+	b, err := j.redis.Get(ctx, refreshKeyPrefix+hash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return tokenPair{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return tokenPair{}, err
+	}
+	var rec refreshRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return tokenPair{}, err
+	}
+	if !j.clock().Before(rec.ExpiresAt) {
+		return tokenPair{}, ErrTokenNotFound
+	}
+	if revoked, err := j.revoked(ctx, rec.Session); err != nil || revoked {
+		return tokenPair{}, orRevoked(err)
+	}
+
+	first, err := j.redis.SetNX(ctx, usedKeyPrefix+hash, 1, rec.ExpiresAt.Sub(j.clock())).Result()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if !first {
+		return tokenPair{}, orRevoked(j.Revoke(ctx, rec.Session))
+	}
+	return j.issue(ctx, rec)
+}
+
+// orRevoked returns err, or ErrTokenRevoked when there is none.
+func orRevoked(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrTokenRevoked
+}
+
+// Revoke ends session. Its refresh tokens expire before the mark does, and
+// its access tokens long before.
+func (j *jwtIssuer) Revoke(ctx context.Context, session string) error {
+	return j.redis.Set(ctx, revokedKeyPrefix+session, 1, j.cfg.RefreshTTL).Err()
+}
+
+// RevokeSubject ends every session of subject but keep, which may be "".
+func (j *jwtIssuer) RevokeSubject(ctx context.Context, subject, keep string) error {
+	key := sessionsKeyPrefix + subject
+	sessions, err := j.redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session == keep {
+			continue
+		}
+		if err := j.Revoke(ctx, session); err != nil {
+			return err
+		}
+		if err := j.redis.SRem(ctx, key, session).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentSession returns the session of the access token req carries when
+// it belongs to subject, or "".
+func (j *jwtIssuer) currentSession(req *http.Request, subject string) string {
+	value, ok := bearerToken(req, false)
+	if !ok {
+		return ""
+	}
+	t, err := j.Token(req.Context(), value)
+	if err != nil || t.Subject != subject {
+		return ""
+	}
+	return t.Session
+}
+
+func (j *jwtIssuer) revoked(ctx context.Context, session string) (bool, error) {
+	err := j.redis.Get(ctx, revokedKeyPrefix+session).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Token verifies an access token. Expiry is left to bearerAuth, which
+// checks it with the clock of Deps.
+func (j *jwtIssuer) Token(ctx context.Context, value string) (Token, error) {
+	var claims accessClaims
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{j.method.Alg()}), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(value, &claims, func(*jwt.Token) (interface{}, error) {
+		return j.verifyKey, nil
+	})
+	if err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	if claims.Issuer != j.cfg.Issuer || claims.ExpiresAt == nil || claims.Session == "" {
+		return Token{}, fmt.Errorf("%w: wrong issuer or missing claims", ErrTokenInvalid)
+	}
+	if revoked, err := j.revoked(ctx, claims.Session); err != nil || revoked {
+		return Token{}, orRevoked(err)
+	}
+	return Token{
+		Subject:   claims.Subject,
+		Scopes:    strings.Fields(claims.Scope),
+		ExpiresAt: claims.ExpiresAt.Time,
+		Session:   claims.Session,
+		Source:    sourceUser,
+	}, nil
+}
+
+// jwtOrStore sends JWTs to the issuer and every other token to store.
+type jwtOrStore struct {
+	jwt   *jwtIssuer
+	store TokenStore
+}
+
+func (s jwtOrStore) Token(ctx context.Context, value string) (Token, error) {
+	if s.jwt != nil && strings.Count(value, ".") == 2 {
+		return s.jwt.Token(ctx, value)
+	}
+	return s.store.Token(ctx, value)
+}
+
+// jwtIssuerOf returns the issuer of deps, or nil with a warning when its
+// key can't be loaded. Logins then issue no tokens.
+func jwtIssuerOf(deps Deps) *jwtIssuer {
+	issuer, err := newJWTIssuer(deps)
+	if err != nil {
+		deps.logger("router").Warnf("jwt: %v, logins issue no tokens", err)
+		return nil
+	}
+	return issuer
+}
+
+// logIn checks l, keeps the user in the session and answers a successful
+// login with a token pair when the issuer is set up.
+func logIn(c *gin.Context, accounts *accounts, issuer *jwtIssuer, l Login) {
+	pair, status, msg := startSession(c, accounts, issuer, l)
+	switch {
+	case status == http.StatusUnauthorized:
+		c.JSON(status, gin.H{"status": "unauthorized"})
+	case status != 0:
+		c.JSON(status, gin.H{"error": msg})
+	default:
+		c.JSON(http.StatusOK, loggedIn(pair))
+	}
+}
+
+// startSession checks l, moves the user to a regenerated session and
+// issues a token pair when the issuer is set up. A failed login returns the
+// status and message to answer with instead.
+func startSession(c *gin.Context, accounts *accounts, issuer *jwtIssuer, l Login) (*tokenPair, int, string) {
+	switch err := accounts.Check(c.Request.Context(), l); {
+	case errors.Is(err, errInvalidLogin):
+		return nil, http.StatusUnauthorized, "unauthorized"
+	case err != nil:
+		c.Error(err)
+		return nil, http.StatusServiceUnavailable, "could not check the login"
+	}
+	// A new ID, so a session ID planted before the login is worthless
+	session := sessions.Get(c)
+	session.Regenerate()
+	session.Set("user", l.User)
+	if issuer == nil {
+		return nil, 0, ""
+	}
+	pair, err := issuer.Login(c.Request.Context(), l.User)
+	if err != nil {
+		c.Error(err)
+		return nil, http.StatusServiceUnavailable, "could not issue tokens"
+	}
+	return &pair, 0, ""
+}
+
+// loggedIn is the flat body of a successful login, with the token pair
+// when there is one.
+func loggedIn(pair *tokenPair) gin.H {
+	body := gin.H{"status": "you are logged in"}
+	if pair != nil {
+		body["access_token"] = pair.AccessToken
+		body["token_type"] = pair.TokenType
+		body["expires_in"] = pair.ExpiresIn
+		body["refresh_token"] = pair.RefreshToken
+	}
+	return body
+}
+
+// refreshRequest is the body of /token/refresh.
+type refreshRequest struct {
+	RefreshToken string `form:"refresh_token" json:"refresh_token" binding:"required"`
+}
+
+// refreshHandler serves /token/refresh. Unknown, expired and reused
+// refresh tokens get 401.
+func refreshHandler(issuer *jwtIssuer) gin.HandlerFunc {
+	return binds(func(c *gin.Context) {
+		var req refreshRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+		pair, err := issuer.Refresh(c.Request.Context(), req.RefreshToken)
+		switch {
+		case errors.Is(err, ErrTokenNotFound):
+			abortProblem(c, newProblem(c, http.StatusUnauthorized, "The refresh token is unknown or expired."))
+			return
+		case errors.Is(err, ErrTokenRevoked):
+			abortProblem(c, newProblem(c, http.StatusUnauthorized, "The refresh token was revoked."))
+			return
+		case err != nil:
+			c.Error(err)
+			abortProblem(c, newProblem(c, http.StatusServiceUnavailable, "Tokens can't be refreshed right now."))
+			return
+		}
+		c.JSON(http.StatusOK, pair)
+	}, refreshRequest{})
+}
+
+// logoutHandler serves /logout behind jwtAuth, revoking the session of the
+// access token and ending the browser session.
+func logoutHandler(issuer *jwtIssuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, _ := principalFrom(c)
+		if err := issuer.Revoke(c.Request.Context(), p.Session); err != nil {
+			c.Error(err)
+			abortProblem(c, newProblem(c, http.StatusServiceUnavailable, "The session can't be ended right now."))
+			return
+		}
+		sessions.Get(c).Destroy()
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// jwtAuth guards routes with the access tokens of issuer only.
+func jwtAuth(deps Deps, issuer *jwtIssuer) gin.HandlerFunc {
+	return bearerAuth(issuer, newRBACPolicy(deps.Config.RBAC), deps.Clock, false, deps.logger("router"))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTLogin(t *testing.T) {
+	router := NewRouter(testDeps())
+	call := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return perform(router, req)
+	}
+	login := func() tokenPair {
+		w := call("/loginJSON", "", `{"user": "manu", "password": "123"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"you are logged in"`)
+		var pair tokenPair
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+		assert.Equal(t, "Bearer", pair.TokenType)
+		assert.EqualValues(t, 900, pair.ExpiresIn)
+		return pair
+	}
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return call("/token/refresh", "", `{"refresh_token": "`+token+`"}`)
+	}
+
+	pair := login()
+	w := call("/ping", pair.AccessToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Authed pong for manu", w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, call("/ping", pair.AccessToken+"x", "").Code)
+
+	// Refresh tokens rotate, and reusing one revokes the whole session.
+	w = refresh(pair.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var next tokenPair
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &next))
+	assert.NotEqual(t, pair.RefreshToken, next.RefreshToken)
+	assert.Equal(t, http.StatusOK, call("/ping", next.AccessToken, "").Code)
+	w = refresh(pair.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "revoked")
+	assert.Equal(t, http.StatusUnauthorized, refresh(next.RefreshToken).Code)
+	assert.Contains(t, call("/ping", next.AccessToken, "").Body.String(), "The token was revoked.")
+	assert.Equal(t, http.StatusUnauthorized, refresh("nope").Code)
+
+	// Logout ends the session of its access token only.
+	pair, other := login(), login()
+	assert.Equal(t, http.StatusUnauthorized, call("/logout", "okay", "").Code)
+	assert.Equal(t, http.StatusNoContent, call("/logout", pair.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/ping", pair.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(pair.RefreshToken).Code)
+	assert.Equal(t, http.StatusOK, call("/ping", other.AccessToken, "").Code)
+
+	// Scopes come from jwt.scopes.
+	req := httptest.NewRequest(http.MethodGet, "/testing/analytics", nil)
+	req.Header.Set("Authorization", "Bearer "+other.AccessToken)
+	assert.Equal(t, http.StatusForbidden, perform(router, req).Code)
+}
+
+func TestPasswordChangeRevokesSessions(t *testing.T) {
+	router := NewRouter(testDeps())
+	call := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return perform(router, req)
+	}
+	login := func(password string) tokenPair {
+		var pair tokenPair
+		w := call("/loginJSON", "", `{"user": "ada", "password": "`+password+`"}`)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+		return pair
+	}
+
+	assert.Equal(t, http.StatusCreated, call("/register", "", `{"user": "ada", "password": "lovelace"}`).Code)
+	current, other := login("lovelace"), login("lovelace")
+	w := call("/password", current.AccessToken, `{"user": "ada", "password": "lovelace", "new_password": "analytical"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The session that changed the password lives on, the others end.
+	assert.Equal(t, http.StatusOK, call("/ping", current.AccessToken, "").Code)
+	assert.Equal(t, http.StatusOK, call("/token/refresh", "", `{"refresh_token": "`+current.RefreshToken+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/ping", other.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/token/refresh", "", `{"refresh_token": "`+other.RefreshToken+`"}`).Code)
+
+	// Without a token of the user, every session ends.
+	next := login("analytical")
+	w = call("/password", "", `{"user": "ada", "password": "analytical", "new_password": "difference"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/ping", next.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/ping", current.AccessToken, "").Code)
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err)
+
+	keys := map[string]string{
+		"HS256": "0123456789abcdef0123456789abcdef",
+		"RS256": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})),
+		"EdDSA": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})),
+	}
+	for alg, key := range keys {
+		deps := testDeps()
+		deps.Config.JWT.Algorithm = alg
+		deps.Secrets = mapSecrets{"jwt_key": key}
+		issuer, err := newJWTIssuer(deps)
+		if !assert.NoError(t, err, alg) {
+			continue
+		}
+
+		pair, err := issuer.Login(context.Background(), "manu")
+		assert.NoError(t, err, alg)
+		tok, err := issuer.Token(context.Background(), pair.AccessToken)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, "manu", tok.Subject, alg)
+		assert.Equal(t, deps.Config.JWT.Scopes, tok.Scopes, alg)
+		assert.Equal(t, deps.Clock().Add(deps.Config.JWT.AccessTTL), tok.ExpiresAt.UTC(), alg)
+
+		// A token of another issuer or algorithm is refused.
+		other := testDeps()
+		other.Secrets = mapSecrets{"jwt_key": "another key of thirty-two bytes!"}
+		foreign, err := newJWTIssuer(other)
+		assert.NoError(t, err)
+		_, err = foreign.Token(context.Background(), pair.AccessToken)
+		assert.ErrorIs(t, err, ErrTokenInvalid, alg)
+	}
+
+	deps := testDeps()
+	deps.Secrets = mapSecrets{"jwt_key": "short"}
+	_, err = newJWTIssuer(deps)
+	assert.Error(t, err)
+	deps.Config.JWT.Algorithm = "RS256"
+	_, err = newJWTIssuer(deps)
+	assert.Error(t, err)
+}
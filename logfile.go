@@ -0,0 +1,181 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat stamps rotated files; it sorts in time order.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// logFile is the file half of gin.DefaultWriter and the standard log
+// package. It rotates by size and by day, and can be reopened at runtime,
+// e.g. after logrotate moved the old file away. It is safe for concurrent use.
+type logFile struct {
+	mu   sync.Mutex
+	cfg  LogConfig
+	f    *os.File
+	size int64
+	day  string
+
+	// mill serializes compression and cleanup of rotated files.
+	mill sync.Mutex
+	now  func() time.Time
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return len(p), nil
+	}
+	if l.shouldRotate(len(p)) {
+		if err := l.rotate(); err != nil {
+			// Keep logging to stderr rather than losing the line.
+			fmt.Fprintf(os.Stderr, "log rotation: %v\n", err)
+			if l.f == nil {
+				return os.Stderr.Write(p)
+			}
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Reopen switches to the file and rotation settings of cfg, creating the
+// file if needed. An empty cfg.File discards.
+func (l *logFile) Reopen(cfg LogConfig) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	l.cfg = cfg
+	if cfg.File == "" {
+		return nil
+	}
+	return l.open()
+}
+
+func (l *logFile) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func (l *logFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.cfg.File), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	// A file left over from an earlier day is rotated on the first write.
+	l.day = info.ModTime().Format("2006-01-02")
+	if info.Size() == 0 {
+		l.day = l.clock().Format("2006-01-02")
+	}
+	return nil
+}
+
+func (l *logFile) shouldRotate(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+	if max := int64(l.cfg.MaxSizeMB) << 20; max > 0 && l.size+int64(n) > max {
+		return true
+	}
+	return l.cfg.Daily && l.clock().Format("2006-01-02") != l.day
+}
+
+// rotate moves the current file aside and starts a new one. Compression and
+// cleanup of old files happen in the background.
+func (l *logFile) rotate() error {
+	l.f.Close()
+	l.f = nil
+
+	ext := filepath.Ext(l.cfg.File)
+	backup := strings.TrimSuffix(l.cfg.File, ext) + "-" + l.clock().Format(backupTimeFormat) + ext
+	if err := os.Rename(l.cfg.File, backup); err != nil {
+		return err
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	go l.millBackups(l.cfg, backup)
+	return nil
+}
+
+func (l *logFile) millBackups(cfg LogConfig, backup string) {
+	l.mill.Lock()
+	defer l.mill.Unlock()
+
+	if cfg.Compress {
+		// A backup pruned by a later rotation is gone already.
+		if err := gzipFile(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "log rotation: %v\n", err)
+		}
+	}
+	if cfg.MaxBackups <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(cfg.File)
+	prefix := strings.TrimSuffix(cfg.File, ext) + "-"
+	matches, _ := filepath.Glob(prefix + "*" + ext)
+	gzipped, _ := filepath.Glob(prefix + "*" + ext + ".gz")
+	backups := append(matches, gzipped...)
+	// Names carry the rotation time, so they sort oldest first.
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	for len(backups) > cfg.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
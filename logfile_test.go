@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gin.log")
+
+	lf := &logFile{}
+	assert.NoError(t, lf.Reopen(LogConfig{File: path}))
+	lf.Write([]byte("first\n"))
+
+	// logrotate moves the file away, then signals a reopen.
+	assert.NoError(t, os.Rename(path, path+".1"))
+	assert.NoError(t, lf.Reopen(LogConfig{File: path}))
+	lf.Write([]byte("second\n"))
+	assert.NoError(t, lf.Reopen(LogConfig{}))
+
+	old, _ := os.ReadFile(path + ".1")
+	cur, _ := os.ReadFile(path)
+	assert.Equal(t, "first\n", string(old))
+	assert.Equal(t, "second\n", string(cur))
+}
+
+func TestLogFileRotatesDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gin.log")
+	now := time.Date(2022, 6, 1, 23, 59, 0, 0, time.UTC)
+
+	lf := &logFile{now: func() time.Time { return now }}
+	assert.NoError(t, lf.Reopen(LogConfig{File: path, Daily: true, Compress: true, MaxBackups: 1}))
+	defer lf.Reopen(LogConfig{})
+
+	lf.Write([]byte("day one\n"))
+	now = now.Add(2 * time.Minute)
+	lf.Write([]byte("day two\n"))
+	now = now.Add(24 * time.Hour)
+	lf.Write([]byte("day three\n"))
+
+	cur, _ := os.ReadFile(path)
+	assert.Equal(t, "day three\n", string(cur))
+
+	// Only the newest backup is kept, compressed.
+	assert.Eventually(t, func() bool {
+		backups, _ := filepath.Glob(filepath.Join(dir, "gin-*"))
+		return len(backups) == 1 && filepath.Ext(backups[0]) == ".gz"
+	}, time.Second, 10*time.Millisecond)
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "gin-*.log.gz"))
+	assert.Len(t, backups, 1)
+	f, _ := os.Open(backups[0])
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(zr)
+	assert.Equal(t, "day two\n", string(b))
+}
+
+func TestLogFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gin.log")
+
+	lf := &logFile{}
+	assert.NoError(t, lf.Reopen(LogConfig{File: path, MaxSizeMB: 1}))
+	defer lf.Reopen(LogConfig{})
+
+	chunk := bytes.Repeat([]byte("x"), 600<<10)
+	lf.Write(chunk)
+	lf.Write(chunk)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(chunk)), info.Size())
+	backups, _ := filepath.Glob(filepath.Join(dir, "gin-*.log"))
+	assert.Len(t, backups, 1)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line. The zero value is info.
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+func (l Level) MarshalText() ([]byte, error) { return []byte(l.String()), nil }
+
+func (l *Level) UnmarshalText(b []byte) error {
+	for _, lvl := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(string(b), lvl.String()) {
+			*l = lvl
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q, want debug, info, warn or error", b)
+}
+
+// logComponents are the loggers besides the route modules.
+var logComponents = []string{"http", "redis", "reload", "router", "server", "sessions"}
+
+// logModuleNames lists every name a module level can be set for.
+func logModuleNames(c *Config) []string {
+	names := append([]string(nil), logComponents...)
+	for name := range c.Modules.byName() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// levelOverride is a temporary change of the configured levels. A nil
+// Level keeps the configured global level.
+type levelOverride struct {
+	Level   *Level           `json:"level"`
+	Modules map[string]Level `json:"modules"`
+}
+
+// logLevels decides which lines are written. An override, set at runtime
+// through the admin endpoint, wins over the configured levels until it
+// expires; within each, a module level wins over the global one.
+type logLevels struct {
+	mu       sync.RWMutex
+	level    Level
+	modules  map[string]Level
+	override *levelOverride
+	until    time.Time
+	timer    *time.Timer
+}
+
+// defaultLevels are the levels of every Logger, set from log.level and
+// log.module_levels.
+var defaultLevels = &logLevels{}
+
+// Configure sets the configured levels, keeping any override.
+func (l *logLevels) Configure(cfg LogConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level, l.modules = cfg.Level, cfg.ModuleLevels
+}
+
+// Level returns the level in effect for module.
+func (l *logLevels) Level(module string) Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if o := l.override; o != nil {
+		if lvl, ok := o.Modules[module]; ok {
+			return lvl
+		}
+		if o.Level != nil {
+			return *o.Level
+		}
+	}
+	if lvl, ok := l.modules[module]; ok {
+		return lvl
+	}
+	return l.level
+}
+
+// Override replaces any earlier override with o until ttl has passed.
+func (l *logLevels) Override(o levelOverride, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.override, l.until = &o, time.Now().Add(ttl)
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// A later override owns a new timer.
+		if l.timer == timer {
+			l.override, l.timer = nil, nil
+		}
+	})
+	l.timer = timer
+}
+
+// Revert drops the override.
+func (l *logLevels) Revert() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.override, l.timer = nil, nil
+}
+
+// Until returns when the override expires, zero without one.
+func (l *logLevels) Until() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.override == nil {
+		return time.Time{}
+	}
+	return l.until
+}
+
+// Logger writes leveled lines for one module to a *log.Logger:
+//
+//	2022/06/01 12:00:00 WARN redis: request_id=4f2a… SET: connection refused
+type Logger struct {
+	module    string
+	levels    *logLevels
+	out       *log.Logger
+	requestID string
+}
+
+// newLogger returns the Logger of module, writing to out.
+func newLogger(module string, out *log.Logger) *Logger {
+	return &Logger{module: module, levels: defaultLevels, out: out}
+}
+
+// stdLogger returns the Logger of module, writing to the standard logger.
+func stdLogger(module string) *Logger {
+	return newLogger(module, log.Default())
+}
+
+// For returns l tagging its lines with the request ID of ctx, which may be
+// a *gin.Context or its copy.
+func (l *Logger) For(ctx context.Context) *Logger {
+	id := requestIDFrom(ctx)
+	if id == "" {
+		return l
+	}
+	cp := *l
+	cp.requestID = id
+	return &cp
+}
+
+// Enabled reports whether lines at lvl are written.
+func (l *Logger) Enabled(lvl Level) bool {
+	return lvl >= l.levels.Level(l.module)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(LevelError, format, args...) }
+
+func (l *Logger) logf(lvl Level, format string, args ...interface{}) {
+	if !l.Enabled(lvl) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(lvl.String()))
+	b.WriteString(" ")
+	b.WriteString(l.module)
+	b.WriteString(": ")
+	if l.requestID != "" {
+		b.WriteString("request_id=")
+		b.WriteString(l.requestID)
+		b.WriteString(" ")
+	}
+	fmt.Fprintf(&b, format, args...)
+	l.out.Output(3, b.String())
+}
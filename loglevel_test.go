@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	defer defaultLevels.Configure(LogConfig{})
+	defaultLevels.Configure(LogConfig{Level: LevelWarn, ModuleLevels: map[string]Level{"redis": LevelDebug}})
+
+	var out bytes.Buffer
+	demo := newLogger("demo", log.New(&out, "", 0))
+	demo.Infof("hidden")
+	demo.Warnf("shown %d", 1)
+	newLogger("redis", log.New(&out, "", 0)).Debugf("shown %d", 2)
+	assert.Equal(t, "WARN demo: shown 1\nDEBUG redis: shown 2\n", out.String())
+
+	defaultLevels.Override(levelOverride{Modules: map[string]Level{"demo": LevelDebug}}, 20*time.Millisecond)
+	assert.True(t, demo.Enabled(LevelDebug))
+	assert.Eventually(t, func() bool { return !demo.Enabled(LevelDebug) }, time.Second, 5*time.Millisecond)
+	assert.True(t, defaultLevels.Until().IsZero())
+}
+
+func TestLoadConfigLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("log:\n  level: WARN\n  module_levels:\n    redis: debug\n    sessions: warn\n"), 0o600))
+
+	cfg, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, cfg.Log.Level)
+	assert.Equal(t, map[string]Level{"redis": LevelDebug, "sessions": LevelWarn}, cfg.Log.ModuleLevels)
+
+	assert.NoError(t, os.WriteFile(path, []byte("log:\n  level: loud\n  module_levels:\n    nope: debug\n"), 0o600))
+	_, err = LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	assert.Error(t, err)
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer defaultLevels.Revert()
+	router := NewRouter(testDeps())
+	call := func(method, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/admin/log/level", strings.NewReader(body))
+		req.SetBasicAuth("foo", "bar")
+		w := perform(router, req)
+		var state map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &state)
+		return w.Code, state
+	}
+
+	code, state := call(http.MethodPut, `{"level": "debug", "modules": {"redis": "error"}, "ttl": "1m"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "debug", state["level"])
+	assert.Equal(t, "error", state["modules"].(map[string]interface{})["redis"])
+	assert.Equal(t, "debug", state["modules"].(map[string]interface{})["demo"])
+	assert.Contains(t, state, "revert_at")
+
+	code, _ = call(http.MethodPut, `{"modules": {"nope": "debug"}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = call(http.MethodPut, `{"level": "debug", "ttl": "48h"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, state = call(http.MethodDelete, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "info", state["level"])
+	assert.NotContains(t, state, "revert_at")
+}
@@ -1,19 +1,319 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestHello(t *testing.T) {
-	router := setupRouter()
+// memStorage keeps uploads in memory instead of on disk.
+type memStorage map[string][]byte
+
+func (m memStorage) Save(file *multipart.FileHeader, name string) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	m[name] = data
+	return err
+}
+
+// fakeRedis implements the few commands the handlers use.
+type fakeRedis struct {
+	redis.Cmdable
+	data map[string]string
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	f.data[key] = fmt.Sprint(value)
+	cmd := redis.NewStatusCmd(ctx)
+	cmd.SetVal("OK")
+	return cmd
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx)
+	if v, ok := f.data[key]; ok {
+		cmd.SetVal(v)
+	} else {
+		cmd.SetErr(redis.Nil)
+	}
+	return cmd
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx)
+	if _, ok := f.data[key]; ok {
+		return cmd
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	f.data[key] = fmt.Sprint(value)
+	cmd.SetVal(true)
+	return cmd
+}
+
+func (f *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx)
+	for _, key := range keys {
+		if _, ok := f.data[key]; ok {
+			delete(f.data, key)
+			cmd.SetVal(cmd.Val() + 1)
+		}
+	}
+	return cmd
+}
+
+func (f *fakeRedis) Incr(ctx context.Context, key string) *redis.IntCmd {
+	n, _ := strconv.ParseInt(f.data[key], 10, 64)
+	n++
+	f.data[key] = strconv.FormatInt(n, 10)
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(n)
+	return cmd
+}
+
+func (f *fakeRedis) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	set := f.set(key)
+	cmd := redis.NewIntCmd(ctx)
+	for _, m := range members {
+		if !set[fmt.Sprint(m)] {
+			set[fmt.Sprint(m)] = true
+			cmd.SetVal(cmd.Val() + 1)
+		}
+	}
+	f.data[key] = strings.Join(sortedKeys(set), " ")
+	return cmd
+}
+
+func (f *fakeRedis) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	set := f.set(key)
+	cmd := redis.NewIntCmd(ctx)
+	for _, m := range members {
+		if set[fmt.Sprint(m)] {
+			delete(set, fmt.Sprint(m))
+			cmd.SetVal(cmd.Val() + 1)
+		}
+	}
+	f.data[key] = strings.Join(sortedKeys(set), " ")
+	return cmd
+}
+
+func (f *fakeRedis) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	cmd := redis.NewStringSliceCmd(ctx)
+	cmd.SetVal(sortedKeys(f.set(key)))
+	return cmd
+}
+
+func (f *fakeRedis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx)
+	_, ok := f.data[key]
+	cmd.SetVal(ok)
+	return cmd
+}
+
+// set reads the space separated members the set commands keep at key.
+func (f *fakeRedis) set(key string) map[string]bool {
+	set := map[string]bool{}
+	for _, m := range strings.Fields(f.data[key]) {
+		set[m] = true
+	}
+	return set
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mapSecrets serves secrets from memory.
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(name string) (Secret, error) {
+	v, ok := m[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return Secret(v), nil
+}
+
+func testDeps() Deps {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		panic(err)
+	}
+	secrets := mapSecrets{
+		"admin_accounts": "foo:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=\naustin:{SHA}cRDtpNCeBiql5KOQsKVyrA0sAiA=",
+		"api_tokens":     "okay demo ping,messages:read,messages:write,analytics:read\nreader reader ping,messages:read\nold demo ping 2022-01-01T00:00:00Z",
+		"jwt_key":        "0123456789abcdef0123456789abcdef",
+		"session_key":    "fedcba9876543210fedcba9876543210",
+		"users":          "manu:$2a$04$MQiD7RxlpnpTE0MrFZHSiOPSD7WND3cB4dJLf3ydDdu06LXK4RheO",
+	}
+	users, err := newUserStore(DefaultConfig().Users, nil, secrets, time.Time{})
+	if err != nil {
+		panic(err)
+	}
+	// The admin accounts and the seeded user hold roles, as in config.yaml.
+	cfg := DefaultConfig()
+	cfg.RBAC.Subjects["admin:foo"] = []string{"operator"}
+	cfg.RBAC.Subjects["admin:austin"] = []string{"operator"}
+	cfg.RBAC.Subjects["user:manu"] = []string{"writer"}
+	return Deps{
+		Config:    cfg,
+		Redis:     &fakeRedis{data: map[string]string{}},
+		Uploads:   memStorage{},
+		Profiles:  memStorage{},
+		Clock:     func() time.Time { return time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC) },
+		Logger:    log.New(io.Discard, "", 0),
+		Secrets:   secrets,
+		Users:     users,
+		Templates: tmpl,
+	}
+}
+
+func perform(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest(http.MethodGet, "/", nil)
 	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHello(t *testing.T) {
+	router := NewRouter(testDeps())
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ohai", w.Body.String())
+}
+
+func TestPing(t *testing.T) {
+	router := NewRouter(testDeps())
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"pong"}`, w.Body.String())
+}
+
+func TestUpload(t *testing.T) {
+	deps := testDeps()
+	router := NewRouter(deps)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("single-file", "hello.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := perform(router, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", string(deps.Uploads.(memStorage)["hello.txt"]))
+}
+
+func TestRedisSet(t *testing.T) {
+	deps := testDeps()
+	router := NewRouter(deps)
+
+	req := httptest.NewRequest(http.MethodPost, "/redis", strings.NewReader(`{"rKey":"k","rValue":"v"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := perform(router, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v", deps.Redis.(*fakeRedis).data["k"])
+}
+
+func TestBookableUsesClock(t *testing.T) {
+	router := NewRouter(testDeps())
+
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/bookable?check_in=2022-06-02&check_out=2022-06-03", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = perform(router, httptest.NewRequest(http.MethodGet, "/bookable?check_in=2022-05-02&check_out=2022-05-03", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTemplates(t *testing.T) {
+	router := NewRouter(testDeps())
+
+	for path, want := range map[string]string{
+		"/index":           "Main website",
+		"/posts/index":     "Using posts/index.tmpl",
+		"/users/index":     "Using users/index.tmpl",
+		"/raw":             "Date: 2017/07/01",
+		"/bind_checkbox":   `name="colors[]"`,
+		"/http2ServerPush": "Welcome, Ginner!",
+	} {
+		w := perform(router, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Body.String(), want, path)
+	}
+}
+
+func TestCollectRoutes(t *testing.T) {
+	servers := map[string]int{}
+	for _, r := range collectRoutes(testDeps()) {
+		servers[r.Server]++
+	}
+	assert.Greater(t, servers["main"], 50)
+	assert.Equal(t, 1, servers["server01"])
+	assert.Equal(t, 1, servers["server02"])
+}
+
+func TestAdminSecrets(t *testing.T) {
+	router := NewRouter(testDeps())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/secrets", nil)
+	req.SetBasicAuth("foo", "bar")
+	w := perform(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "foo@bar.com")
+
+	req.SetBasicAuth("foo", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, perform(router, req).Code)
+}
+
+func TestModulesConfig(t *testing.T) {
+	deps := testDeps()
+	deps.Config.Modules.Demo.Enabled = false
+	deps.Config.Modules.Rendering.Prefix = "/render"
+	router := NewRouter(deps)
+
+	assert.Equal(t, http.StatusNotFound, perform(router, httptest.NewRequest(http.MethodGet, "/panic", nil)).Code)
+	assert.Equal(t, http.StatusNotFound, perform(router, httptest.NewRequest(http.MethodGet, "/someJSON", nil)).Code)
+	assert.Equal(t, http.StatusOK, perform(router, httptest.NewRequest(http.MethodGet, "/render/someJSON", nil)).Code)
+}
+
+func TestRouterRedirectWithPrefix(t *testing.T) {
+	deps := testDeps()
+	deps.Config.Modules.Demo.Prefix = "/demo"
+	router := NewRouter(deps)
 
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/demo/test1", nil))
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "Hiya!", w.Body.String())
+	assert.JSONEq(t, `{"hello":"world"}`, w.Body.String())
 }
@@ -0,0 +1,898 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"kopever/gin-demo/testdata/protoexample"
+)
+
+// Module is a feature area of the main engine. Each one can be switched on
+// or off and mounted at its own prefix, see ModulesConfig.
+type Module interface {
+	Name() string
+	Register(router *gin.RouterGroup)
+}
+
+// modules lists every feature area in registration order.
+func modules(engine *gin.Engine, deps Deps) []Module {
+	return []Module{
+		demoModule{engine: engine, deps: deps},
+		authModule{deps: deps},
+		bindingModule{deps: deps},
+		uploadsModule{deps: deps},
+		renderingModule{},
+		staticModule{},
+		templatesModule{deps: deps},
+		adminModule{deps: deps},
+		redisModule{deps: deps},
+		debugModule{deps: deps},
+		docsModule{deps: deps},
+	}
+}
+
+// demoModule serves the small gin demos: parameters, forms, redirects,
+// middleware and goroutines.
+type demoModule struct {
+	engine *gin.Engine
+	deps   Deps
+}
+
+func (demoModule) Name() string { return "demo" }
+
+func (m demoModule) Register(router *gin.RouterGroup) {
+	logger := m.deps.logger(m.Name())
+	red := m.deps.Config.redactor()
+
+	router.GET("/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "pong",
+		})
+	})
+
+	// Parameters in path
+	router.GET("/user/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		c.String(http.StatusOK, "Hello %s", name)
+	})
+	router.GET("/user/:name/*action", func(c *gin.Context) {
+		name := c.Param("name")
+		action := c.Param("action")
+		message := name + " is " + action
+		c.String(http.StatusOK, message)
+	})
+	router.POST("/user/:name/*action", func(c *gin.Context) {
+		b := c.FullPath() == "/user/:name/*action"
+		c.String(http.StatusOK, "%t", b)
+	})
+	router.GET("/user/groups", func(c *gin.Context) {
+		c.String(http.StatusOK, "The available groups are [...]")
+	})
+
+	// Querystring parameters
+	router.GET("/welcome", func(c *gin.Context) {
+		firstname := c.DefaultQuery("firstname", "Guest")
+		lastname := c.Query("lastname")
+
+		c.String(http.StatusOK, "Hello %s %s", firstname, lastname)
+	})
+
+	// Multipart/Urlencoded Form
+	router.POST("/form_post", func(c *gin.Context) {
+		message := c.PostForm("message")
+		nick := c.DefaultPostForm("nick", "anonymous")
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "posted",
+			"message": message,
+			"nick":    nick,
+		})
+	})
+
+	// Another example: query + post form
+	router.POST("/post", func(c *gin.Context) {
+		id := c.Query("id")
+		page := c.DefaultQuery("page", "0")
+		name := c.PostForm("name")
+		message := c.PostForm("message")
+
+		logger.For(c).Debugf("id: %s; page: %s; name: %s; message: %s",
+			red.Param("id", id), red.Param("page", page), red.Param("name", name), red.Param("message", message))
+
+		c.String(http.StatusOK, "ok")
+	})
+
+	// Map as querystring or postform parameters
+	router.POST("/post_map", func(c *gin.Context) {
+		ids := c.QueryMap("ids")
+		names := c.PostFormMap("names")
+
+		logger.For(c).Debugf("ids: %v; names: %v", red.Values(ids), red.Values(names))
+
+		c.String(http.StatusOK, "ok")
+	})
+
+	router.GET("/panic", func(ctx *gin.Context) {
+		panic("foo")
+	})
+	router.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ohai")
+	})
+
+	// Serving data from reader
+	router.GET("/someDataFromReader", func(c *gin.Context) {
+		response, err := http.Get("https://raw.githubusercontent.com/gin-gonic/logo/master/color.png")
+		if err != nil || response.StatusCode != http.StatusOK {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+
+		reader := response.Body
+		defer reader.Close()
+		contentLength := response.ContentLength
+		contentType := response.Header.Get("Content-Type")
+
+		extraHeaders := map[string]string{
+			"Content-Disposition": `attachment; filename="gopher.png"`,
+		}
+
+		c.DataFromReader(http.StatusOK, contentLength, contentType, reader, extraHeaders)
+	})
+
+	// Multitemplate
+	// Redirects
+	router.GET("/test", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "http://www.google.com/")
+	})
+	// Redirect from POST
+	router.POST("/testPost", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/foo")
+	})
+	// Router redirect
+	router.GET("/test1", func(c *gin.Context) {
+		c.Request.URL.Path = path.Join(router.BasePath(), "/test2")
+		m.engine.HandleContext(c)
+	})
+	router.GET("/test2", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"hello": "world"})
+	})
+
+	// Custom Middleware
+	router.Use(Example())
+	router.GET("/customMiddleware", func(c *gin.Context) {
+		example := c.MustGet("example").(string)
+		logger.For(c).Infof("%s", example)
+	})
+
+	// Goroutines inside a middleware
+	router.GET("/long_async", func(c *gin.Context) {
+		cCp := c.Copy()
+
+		go func() {
+			time.Sleep(3 * time.Second)
+			logger.For(cCp).Infof("Done! in path %s", cCp.Request.URL.Path)
+		}()
+
+		c.String(http.StatusOK, "Done!")
+	})
+	router.GET("/long_sync", func(c *gin.Context) {
+		time.Sleep(3 * time.Second)
+		logger.For(c).Infof("Done! in path %s", c.Request.URL.Path)
+		c.String(http.StatusOK, "Done!")
+	})
+
+	// Support Let's Encrypt
+	// router.GET("/tls", func(c *gin.Context) {
+	// 	c.String(http.StatusOK, "Support Let's Encrypt")
+	// })
+	// manager := autocert.Manager{
+	// 	Prompt:     autocert.AcceptTOS,
+	// 	HostPolicy: autocert.HostWhitelist("example1.com", "example2.com"),
+	// 	Cache:      autocert.DirCache("/var/www/.cache"),
+	// }
+	// log.Fatal(autotls.Run(router, "example1.com", "example2.com"))
+	// log.Fatal(autotls.RunWithManager(router, &manager))
+
+	// Set and get a cookie
+	router.GET("/cookie", func(c *gin.Context) {
+		cookie, err := c.Cookie("gin_cookie")
+		if err != nil {
+			cookie = "NotSet"
+			c.SetCookie("gin_cookie", "test", 3600, "/", "", false, true)
+		}
+		logger.For(c).Debugf("Cookie value: %s", red.Cookie("gin_cookie", cookie))
+		c.String(http.StatusOK, cookie)
+	})
+
+	// The server-side session, see sessions.Get
+	router.GET("/session", func(c *gin.Context) {
+		session := sessions.Get(c)
+		visits, _ := strconv.Atoi(session.Get("visits"))
+		session.Set("visits", strconv.Itoa(visits+1))
+		c.JSON(http.StatusOK, gin.H{"user": session.Get("user"), "visits": visits + 1})
+	})
+
+	router.GET("/setTrustedProxies", func(c *gin.Context) {
+		logger.For(c).Debugf("Client IP: %s", c.ClientIP())
+		logger.For(c).Debugf("Remote IP: %s", c.RemoteIP())
+	})
+}
+
+// authModule serves the login endpoints, the versioned API and the token
+// protected groups.
+type authModule struct {
+	deps Deps
+}
+
+func (authModule) Name() string { return "auth" }
+
+func (m authModule) Register(router *gin.RouterGroup) {
+	issuer := jwtIssuerOf(m.deps)
+	accounts := newAccounts(m.deps)
+	auth := tokenAuth(m.deps, issuer)
+	api := apiHandlers{svc: messageService{redis: m.deps.Redis, clock: m.deps.Clock}, accounts: accounts, issuer: issuer, auth: auth}
+
+	// Grouping routes
+	// Simple group: v1
+	v1 := router.Group("/v1")
+	// Simple group: v2
+	v2 := router.Group("/v2")
+	// Version picked by Accept or API-Version
+	negotiated := router.Group("/api")
+
+	v1.Use(apiVersion(1, m.deps.Config.API, v1.BasePath(), v2.BasePath()))
+	api.register(v1, 1)
+	v2.Use(apiVersion(2, m.deps.Config.API, v2.BasePath(), v2.BasePath()))
+	api.register(v2, 2)
+	negotiated.Use(apiVersion(0, m.deps.Config.API, negotiated.BasePath(), v2.BasePath()))
+	api.register(negotiated, 0)
+
+	// Using middleware
+	authorized := router.Group("/")
+	// authorized.Use(gin.Logger())
+	// authorized.Use(gin.Recovery())
+	authorized.Use(auth)
+	{
+		authorized.POST("/ping", Require("ping"), ping())
+		authorized.POST("/submit", Require("messages:write"), binds(func(c *gin.Context) {
+			var req authedMessage
+			if err := c.ShouldBind(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+				return
+			}
+			principal, _ := principalFrom(c)
+			msg, err := api.svc.submit(c.Request.Context(), principal.Subject, req.Message)
+			if err != nil {
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not store the message"})
+				return
+			}
+			c.JSON(http.StatusCreated, msg)
+		}, authedMessage{}))
+		authorized.POST("/read", Require("messages:read"), binds(func(c *gin.Context) {
+			var req readRequest
+			if err := c.ShouldBind(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+				return
+			}
+			msg, err := api.svc.read(c.Request.Context(), req.ID)
+			if errors.Is(err, errMessageNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read the message"})
+				return
+			}
+			c.JSON(http.StatusOK, msg)
+		}, readRequest{}))
+
+		// nested group
+		testing := authorized.Group("testing", Require("analytics:read"))
+		// visit 0.0.0.0:8080/testing/analytics
+		testing.GET("/analytics", func(c *gin.Context) {
+			count, err := api.svc.count(c.Request.Context())
+			if err != nil {
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not count the messages"})
+				return
+			}
+			principal, _ := principalFrom(c)
+			c.JSON(http.StatusOK, gin.H{"principal": principal, "messages": count})
+		})
+	}
+
+	// Model binding and validation
+	router.POST("/loginJSON", binds(func(c *gin.Context) {
+		var json Login
+		if err := c.ShouldBindJSON(&json); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		logIn(c, accounts, issuer, json)
+	}, Login{}))
+
+	router.POST("/loginXML", binds(func(c *gin.Context) {
+		var xml Login
+		if err := c.ShouldBindXML(&xml); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		logIn(c, accounts, issuer, xml)
+	}, Login{}))
+
+	router.POST("/loginForm", binds(func(c *gin.Context) {
+		var form Login
+		// This will infer what binder to use depending on the content-type header.
+		if err := c.ShouldBind(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		logIn(c, accounts, issuer, form)
+	}, Login{}))
+
+	// Accounts of the logins above
+	router.POST("/register", binds(func(c *gin.Context) {
+		var form registration
+		if err := c.ShouldBind(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		switch err := accounts.Register(c.Request.Context(), Login(form)); {
+		case errors.Is(err, ErrUserExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "user exists"})
+		case err != nil:
+			c.Error(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not register the user"})
+		default:
+			c.JSON(http.StatusCreated, gin.H{"user": form.User})
+		}
+	}, registration{}))
+
+	router.POST("/password", binds(func(c *gin.Context) {
+		var form passwordChange
+		if err := c.ShouldBind(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		switch err := accounts.ChangePassword(c.Request.Context(), form.Login, form.NewPassword); {
+		case errors.Is(err, errInvalidLogin):
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+			return
+		case err != nil:
+			c.Error(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not change the password"})
+			return
+		}
+		// The old password may be known to others: end their sessions,
+		// but not the one asking.
+		if issuer != nil {
+			keep := issuer.currentSession(c.Request, form.User)
+			if err := issuer.RevokeSubject(c.Request.Context(), form.User, keep); err != nil {
+				c.Error(err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "password changed, but other sessions could not be ended"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "password changed"})
+	}, passwordChange{}))
+
+	// Access and refresh tokens of the logins above
+	if issuer != nil {
+		router.POST("/token/refresh", refreshHandler(issuer))
+		router.POST("/logout", jwtAuth(m.deps, issuer), Require("logout"), logoutHandler(issuer))
+	}
+}
+
+// bindingModule serves model binding and validation.
+type bindingModule struct {
+	deps Deps
+}
+
+func (bindingModule) Name() string { return "binding" }
+
+func (m bindingModule) Register(router *gin.RouterGroup) {
+	logger := m.deps.logger(m.Name())
+
+	// Custom Validators
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("bookabledate", bookableDate(m.deps.Clock))
+	}
+	router.GET("/bookable", binds(getBookable, Book{}))
+
+	// Only Bind Query String
+	router.Any("/testing", binds(startPage(logger), Person{}))
+
+	// Bind Query String or Post Data
+	router.Any("/testing1", binds(startPage1(logger), Person{}))
+
+	// Bind Uri
+	router.GET("/:name/:id", binds(func(c *gin.Context) {
+		people := People{}
+		if err := c.ShouldBindUri(&people); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": bindError(err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"name": people.Name, "uuid": people.ID})
+	}, People{}))
+
+	// Bind Header
+	router.GET("/bind_header", binds(func(c *gin.Context) {
+		h := testHeader{}
+		if err := c.ShouldBindHeader(&h); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+
+		logger.For(c).Debugf("%#v", redactValue(h))
+		c.JSON(http.StatusOK, gin.H{"Rate": h.Rate, "Domain": h.Domain})
+	}, testHeader{}))
+
+	// Bind HTML checkboxes
+	// router.LoadHTMLFiles("checkbox.html")
+
+	router.POST("/bind_checkbox", binds(checkboxPostHandler, checkboxForm{}))
+
+	// Bind form-data request with custom struct
+	router.GET("/getb", binds(func(c *gin.Context) {
+		var b StructB
+		c.Bind(&b)
+		c.JSON(http.StatusOK, gin.H{
+			"a": b.NestedStruct,
+			"b": b.FieldB,
+		})
+	}, StructB{}))
+
+	router.GET("/getc", binds(func(c *gin.Context) {
+		var sc StructC
+		c.Bind(&sc)
+		c.JSON(http.StatusOK, gin.H{
+			"a": sc.NestedStructPointer,
+			"c": sc.FieldC,
+		})
+	}, StructC{}))
+
+	router.GET("/getd", binds(func(c *gin.Context) {
+		var d StructD
+		c.Bind(&d)
+		c.JSON(http.StatusOK, gin.H{
+			"x": d.NestedAnonyStruct,
+			"d": d.FieldD,
+		})
+	}, StructD{}))
+
+	// Try to bind body into different structs
+	router.POST("/bindDiffStructs", binds(func(c *gin.Context) {
+		objA := formA{}
+		objB := formB{}
+
+		// if errA := c.ShouldBind(&objA); errA == nil {
+		// 	c.String(http.StatusOK, "the body should be formA")
+		// } else if errB := c.ShouldBind(&objB); errB == nil {
+		// 	c.String(http.StatusOK, "the body should be formB")
+		// } else {
+		// 	c.String(http.StatusOK, "unknown body")
+		// }
+
+		if errA := c.ShouldBindWith(&objA, binding.Form); errA == nil {
+			c.String(http.StatusOK, `the body should be formA Form`)
+		} else if errB := c.ShouldBindBodyWith(&objB, binding.JSON); errB == nil {
+			c.String(http.StatusOK, `the body should be formB JSON`)
+		} else if errB2 := c.ShouldBindBodyWith(&objB, binding.XML); errB2 == nil {
+			c.String(http.StatusOK, `the body should be formB XML`)
+		} else {
+			c.String(http.StatusOK, "unknown body")
+		}
+	}, formA{}, formB{}))
+
+	// Bind form-data request with custom struct and custom tag
+	router.POST("/bindCustom", binds(func(c *gin.Context) {
+		var urlBinding = customerBinding{}
+		var opt FormA
+		err := c.MustBindWith(&opt, urlBinding)
+		logger.For(c).Debugf("opt: %+v", redactValue(opt))
+		if err != nil {
+			c.String(http.StatusBadRequest, "binding error")
+		} else {
+			c.String(http.StatusOK, "okay")
+		}
+	}, FormA{}))
+}
+
+// uploadsModule serves file uploads.
+type uploadsModule struct {
+	deps Deps
+}
+
+func (uploadsModule) Name() string { return "uploads" }
+
+func (m uploadsModule) Register(router *gin.RouterGroup) {
+	logger := m.deps.logger(m.Name())
+
+	// Upload files
+
+	// Single file
+	router.POST("/upload", func(c *gin.Context) {
+		file, err := c.FormFile("single-file")
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get form file err: %s", err.Error()))
+		} else {
+			filename := file.Filename
+			logger.For(c).Infof("%s", filename)
+
+			if err := m.deps.Uploads.Save(file, filename); err != nil {
+				c.String(http.StatusInternalServerError, fmt.Sprintf("save file err: %s", err.Error()))
+				return
+			}
+
+			c.String(http.StatusOK, fmt.Sprintf("'%s' uploaded!", filename))
+		}
+	})
+	// Multiple files
+	router.POST("/upload_multiple", func(c *gin.Context) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get form files err: %s", err.Error()))
+		} else {
+			files := form.File["multiple-files"]
+			if len(files) == 0 {
+				c.String(http.StatusBadRequest, "no files received")
+			} else {
+				for _, file := range files {
+					filename := file.Filename
+					logger.For(c).Infof("%s", filename)
+
+					if err := m.deps.Uploads.Save(file, filename); err != nil {
+						c.String(http.StatusInternalServerError, fmt.Sprintf("save file err: %s", err.Error()))
+						return
+					}
+				}
+				c.String(http.StatusOK, fmt.Sprintf("%d files uploaded!", len(files)))
+			}
+		}
+	})
+
+	// Multipart/Urlencoded binding
+	router.POST("/profile", binds(profileHandler(m.deps.Profiles), profileForm{}))
+}
+
+// renderingModule serves XML, JSON, YAML and ProtoBuf rendering.
+type renderingModule struct{}
+
+func (renderingModule) Name() string { return "rendering" }
+
+func (renderingModule) Register(router *gin.RouterGroup) {
+	// XML, JSON, YAML and ProtoBuf rendering
+	router.GET("/someJSON", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "hey", "status": http.StatusOK})
+	})
+	router.GET("/moreJSON", func(c *gin.Context) {
+		var msg struct {
+			Name    string `json:"user"`
+			Message string
+			Number  int
+		}
+		msg.Name = "Lena"
+		msg.Message = "hey"
+		msg.Number = 123
+		c.JSON(http.StatusOK, msg)
+	})
+	router.GET("/someXML", func(c *gin.Context) {
+		c.XML(http.StatusOK, gin.H{"message": "hey", "status": http.StatusOK})
+	})
+	router.GET("/someYAML", func(c *gin.Context) {
+		c.YAML(http.StatusOK, gin.H{"message": "hey", "status": http.StatusOK})
+	})
+	router.GET("/someProtoBuf", func(c *gin.Context) {
+		reps := []int64{int64(1), int64(2)}
+		label := "test"
+		data := &protoexample.Test{
+			Label: &label,
+			Reps:  reps,
+		}
+		c.ProtoBuf(http.StatusOK, data)
+	})
+
+	// SecureJSON
+	// router.SecureJsonPrefix(")]}',\n")
+	router.GET("/someJSONSecure", func(c *gin.Context) {
+		names := []string{"lena", "austin", "foo"}
+		c.SecureJSON(http.StatusOK, names)
+	})
+
+	// JSONP
+	router.GET("/JSONP", func(c *gin.Context) {
+		data := gin.H{
+			"foo": "bar",
+		}
+		c.JSONP(http.StatusOK, data)
+		// curl http://127.0.0.1:8080/JSONP?callback=x
+	})
+
+	// AsciiJSON
+	router.GET("/someJSONAscii", func(c *gin.Context) {
+		data := gin.H{
+			"lang": "GO 语言",
+			"tag":  "<br>",
+		}
+		c.AsciiJSON(http.StatusOK, data)
+	})
+
+	// PureJSON
+	router.GET("/json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"html": "<b>Hello, world!</b>",
+		})
+	})
+	router.GET("/purejson", func(c *gin.Context) {
+		c.PureJSON(http.StatusOK, gin.H{
+			"html": "<b>Hello, world!</b>",
+		})
+	})
+}
+
+// staticModule serves static files.
+type staticModule struct{}
+
+func (staticModule) Name() string { return "static" }
+
+func (staticModule) Register(router *gin.RouterGroup) {
+	// Serving static files
+	router.Static("/assets", "./assets")
+	router.StaticFS("/more_static", http.Dir("my_file_system"))
+	router.StaticFile("/favicon.ico", "./resources/favicon.svg")
+	router.StaticFileFS("/more_favicon.ico", "ok.png", http.Dir("my_file_system"))
+
+	// Serving data from file
+	router.GET("/local/file", func(c *gin.Context) {
+		c.File("local/hello.go")
+	})
+	var fs http.FileSystem = http.Dir(".")
+	router.GET("/fs/file", func(c *gin.Context) {
+		c.FileFromFS("local/world.go", fs)
+	})
+}
+
+// templatesModule serves HTML pages rendered from the shared template set.
+type templatesModule struct {
+	deps Deps
+}
+
+func (templatesModule) Name() string { return "templates" }
+
+func (m templatesModule) Register(router *gin.RouterGroup) {
+	logger := m.deps.logger(m.Name())
+
+	// HTML rendering, the template set is loaded by NewRouter
+	// router.LoadHTMLFiles("templates/template1.html", "templates/template2.html")
+	// router.LoadHTMLFiles("templates/index.tmpl")
+	// router.LoadHTMLGlob("templates/*.tmpl")
+	// tmpl := template.Must(template.ParseFiles("templates/index.tmpl"))
+	// router.SetHTMLTemplate(tmpl)
+	router.GET("/index", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.tmpl", gin.H{
+			"title": "Main website",
+			"user":  sessions.Get(c).Get("user"),
+		})
+	})
+	// router.LoadHTMLGlob("templates/**/*")
+	// router.LoadHTMLFiles("templates/posts/index.tmpl", "templates/users/index.tmpl")
+	router.GET("/posts/index", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "posts/index.tmpl", gin.H{
+			"title": "Posts",
+		})
+	})
+	router.GET("/users/index", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "users/index.tmpl", gin.H{
+			"title": "Users",
+		})
+	})
+
+	// Custom Template renderer
+	// html := template.Must(template.ParseFiles("templates/template1.tmpl", "templates/template2.tmpl"))
+	// router.SetHTMLTemplate(html)
+	// Custom Delimiters
+	// router.Delims("{[{", "}]}")
+	// router.SetFuncMap(template.FuncMap{
+	// 	"formatAsDate": formatAsDate,
+	// })
+	// Custom Template Funcs
+	// router.LoadHTMLFiles("testdata/template/raw.tmpl")
+	router.GET("/raw", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "raw.tmpl", gin.H{
+			"now": time.Date(2017, 07, 01, 0, 0, 0, 0, time.UTC),
+		})
+	})
+
+	// Bind HTML checkboxes
+
+	router.GET("/bind_checkbox", checkboxGetHandler)
+
+	// http2 server push
+	// router.Static("/assets", "./assets")
+	// router.SetHTMLTemplate(html1)
+	router.GET("/http2ServerPush", func(c *gin.Context) {
+		if pusher := c.Writer.Pusher(); pusher != nil {
+			if err := pusher.Push("/assets/app.js", nil); err != nil {
+				logger.For(c).Warnf("Failed to push: %v", err)
+			}
+		}
+		c.HTML(http.StatusOK, "http2", gin.H{
+			"status": "success",
+		})
+	})
+}
+
+// adminModule serves the BasicAuth protected admin area.
+type adminModule struct {
+	deps Deps
+}
+
+func (adminModule) Name() string { return "admin" }
+
+func (m adminModule) Register(router *gin.RouterGroup) {
+	// Using BasicAuth() middleware
+	// The group is mounted at /admin by default.
+	router.Use(adminAuth(m.deps))
+
+	// Demo data of the accounts
+	secrets := map[string]gin.H{
+		"foo":    {"email": "foo@bar.com", "phone": "123433"},
+		"austin": {"email": "austin@example.com", "phone": "666"},
+		"lena":   {"email": "lena@guapa.com", "phone": "523443"},
+	}
+	router.GET("/secrets", Require("admin:secrets"), func(c *gin.Context) {
+		user := c.MustGet(gin.AuthUserKey).(string)
+		if secret, ok := secrets[user]; ok {
+			c.JSON(http.StatusOK, gin.H{"user": user, "secret": secret})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"user": user, "secret": "NO SECRET :("})
+		}
+	})
+
+	// Runtime log levels, reverting to the configured ones after a while
+	router.GET("/log/level", Require("admin:log:read"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, logLevelState(m.deps.Config))
+	})
+	router.PUT("/log/level", Require("admin:log:write"), binds(func(c *gin.Context) {
+		var req logLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindError(err)})
+			return
+		}
+		ttl, err := req.ttl(m.deps.Config)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		known := map[string]bool{}
+		for _, name := range logModuleNames(m.deps.Config) {
+			known[name] = true
+		}
+		for name := range req.Modules {
+			if !known[name] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown module %q", name)})
+				return
+			}
+		}
+		defaultLevels.Override(levelOverride{Level: req.Level, Modules: req.Modules}, ttl)
+		m.deps.logger("admin").For(c).Warnf("%s set log levels for %s", c.GetString(gin.AuthUserKey), ttl)
+		c.JSON(http.StatusOK, logLevelState(m.deps.Config))
+	}, logLevelRequest{}))
+	router.DELETE("/log/level", Require("admin:log:write"), func(c *gin.Context) {
+		defaultLevels.Revert()
+		c.JSON(http.StatusOK, logLevelState(m.deps.Config))
+	})
+}
+
+// logLevelRequest is the body of PUT /admin/log/level.
+type logLevelRequest struct {
+	Level   *Level           `json:"level"`
+	Modules map[string]Level `json:"modules"`
+	// TTL is a duration such as "10m", log.level_ttl when empty.
+	TTL string `json:"ttl"`
+}
+
+// maxLevelTTL bounds how long a runtime level can stay in effect.
+const maxLevelTTL = 24 * time.Hour
+
+func (r logLevelRequest) ttl(cfg *Config) (time.Duration, error) {
+	if r.TTL == "" {
+		return cfg.Log.LevelTTL, nil
+	}
+	ttl, err := time.ParseDuration(r.TTL)
+	if err != nil || ttl <= 0 || ttl > maxLevelTTL {
+		return 0, fmt.Errorf("ttl must be a duration between 0 and %s", maxLevelTTL)
+	}
+	return ttl, nil
+}
+
+// logLevelState reports the levels in effect and when they revert.
+func logLevelState(cfg *Config) gin.H {
+	modules := map[string]Level{}
+	for _, name := range logModuleNames(cfg) {
+		modules[name] = defaultLevels.Level(name)
+	}
+	state := gin.H{"level": defaultLevels.Level(""), "modules": modules}
+	if until := defaultLevels.Until(); !until.IsZero() {
+		state["revert_at"] = until
+	}
+	return state
+}
+
+// redisModule serves the Redis demo.
+type redisModule struct {
+	deps Deps
+}
+
+func (redisModule) Name() string { return "redis" }
+
+func (m redisModule) Register(router *gin.RouterGroup) {
+
+	// Redis test
+	router.POST("/redis", binds(func(c *gin.Context) {
+		var redisKVData redisKVData
+		if err := c.ShouldBindJSON(&redisKVData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"bind error": bindError(err)})
+			return
+		}
+		if err := m.deps.Redis.Set(c.Request.Context(), redisKVData.RKey, redisKVData.RValue, 0).Err(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"redis error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": "0"})
+	}, redisKVData{}))
+}
+
+// debugModule describes the running server to admin accounts.
+type debugModule struct {
+	deps Deps
+}
+
+func (debugModule) Name() string { return "debug" }
+
+func (m debugModule) Register(router *gin.RouterGroup) {
+	// The middleware chains show how every route authenticates.
+	router.Use(adminAuth(m.deps))
+
+	// Every route of the main engine, server01 and server02
+	router.GET("/routes", Require("admin:routes"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, m.deps.Routes.Routes())
+	})
+}
+
+// docsModule serves the OpenAPI document of the main engine and a Swagger UI
+// page showing it.
+type docsModule struct {
+	deps Deps
+}
+
+func (docsModule) Name() string { return "docs" }
+
+func (m docsModule) Register(router *gin.RouterGroup) {
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, buildOpenAPI(m.deps.Routes.Routes()))
+	})
+	router.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+	})
+	assets, _ := fs.Sub(swaggerUI, "swagger-ui")
+	for _, name := range swaggerUIAssets {
+		router.StaticFileFS("/docs/ui/"+name, name, http.FS(assets))
+	}
+}
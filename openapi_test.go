@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	router := NewRouter(testDeps())
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc openAPI
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	bookable := doc.Paths["/bookable"]["get"]
+	if assert.Len(t, bookable.Parameters, 2) {
+		checkOut := bookable.Parameters[1]
+		assert.Equal(t, "check_out", checkOut.Name)
+		assert.Equal(t, "query", checkOut.In)
+		assert.True(t, checkOut.Required)
+		assert.Equal(t, "date", checkOut.Schema.Format)
+		assert.Equal(t, "Must be greater than check_in.", checkOut.Schema.Description)
+	}
+
+	people := doc.Paths["/{name}/{id}"]["get"]
+	if assert.Len(t, people.Parameters, 2) {
+		assert.Equal(t, "path", people.Parameters[1].In)
+		assert.Equal(t, "uuid", people.Parameters[1].Schema.Format)
+	}
+
+	header := doc.Paths["/bind_header"]["get"]
+	if assert.Len(t, header.Parameters, 2) {
+		assert.Equal(t, parameter{Name: "Rate", In: "header", Schema: &schema{Type: "string"}}, *header.Parameters[0])
+	}
+
+	login := doc.Paths["/loginJSON"]["post"]
+	assert.Equal(t, "#/components/schemas/Login", login.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, login.RequestBody.Content, "application/x-www-form-urlencoded")
+	assert.Equal(t, []string{"password", "user"}, doc.Components.Schemas["Login"].Required)
+
+	profile := doc.Paths["/profile"]["post"].RequestBody.Content
+	assert.NotContains(t, profile, "application/x-www-form-urlencoded")
+	assert.Equal(t, "binary", profile["multipart/form-data"].Schema.Properties["avatar"].Format)
+
+	submit := doc.Components.Schemas["submitV2"].Properties["text"]
+	assert.Equal(t, 1000, *submit.MaxLength)
+	// v2 takes JSON only, v1 forms too.
+	v2 := doc.Paths["/v2/submit"]["post"]
+	assert.Equal(t, []string{"application/json"}, contentTypes(v2.RequestBody.Content))
+	assert.Contains(t, doc.Paths["/v1/submit"]["post"].RequestBody.Content, "application/x-www-form-urlencoded")
+	assert.Contains(t, v2.Responses, "403")
+	assert.NotContains(t, login.Responses, "403")
+
+	assert.Equal(t, []map[string][]string{{"bearer": {}}}, v2.Security)
+	assert.Equal(t, "bearer", doc.Components.SecuritySchemes["bearer"].Scheme)
+
+	// The document is public: no admin routes and no handler names.
+	for path := range doc.Paths {
+		assert.NotRegexp(t, `^/(admin|debug)(/|$)`, path)
+	}
+	assert.NotContains(t, doc.Components.SecuritySchemes, "basic")
+	assert.NotContains(t, w.Body.String(), "x-handler")
+
+	w = perform(router, httptest.NewRequest(http.MethodGet, "/docs/ui/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "SwaggerUIBundle")
+	w = perform(router, httptest.NewRequest(http.MethodGet, "/docs/ui/swagger-ui.css", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = perform(router, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "openapi.json"`)
+	assert.Contains(t, w.Body.String(), `src="docs/ui/swagger-ui-bundle.js"`)
+	assert.NotContains(t, w.Body.String(), "https://")
+}
+
+func contentTypes(m map[string]mediaType) []string {
+	var list []string
+	for k := range m {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
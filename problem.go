@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problem is an RFC 7807 problem document, the error body for API clients
+// of responses that no handler shapes, like 404 and 405.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+	// Allow lists the methods the path supports on 405.
+	Allow []string `json:"allow,omitempty"`
+	// Suggestion is the closest route to a path that matched none.
+	Suggestion string `json:"suggestion,omitempty"`
+	// Permission is the one missing on 403, see Require.
+	Permission string `json:"permission,omitempty"`
+}
+
+const problemContentType = "application/problem+json"
+
+// newProblem returns the problem of status for the request of c.
+func newProblem(c *gin.Context, status int, detail string) problem {
+	return problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		RequestID: c.GetString(requestIDKey),
+	}
+}
+
+// writeProblem sends p as HTML to browsers when tmpl has the error page,
+// and as a problem document to everyone else.
+func writeProblem(c *gin.Context, tmpl *template.Template, p problem) {
+	if tmpl != nil && tmpl.Lookup("error.tmpl") != nil &&
+		c.NegotiateFormat(gin.MIMEJSON, problemContentType, gin.MIMEHTML) == gin.MIMEHTML {
+		c.HTML(p.Status, "error.tmpl", gin.H{
+			"status":     p.Status,
+			"title":      p.Title,
+			"detail":     p.Detail,
+			"allow":      p.Allow,
+			"suggestion": p.Suggestion,
+			"request_id": p.RequestID,
+		})
+		return
+	}
+	c.Header("Content-Type", problemContentType)
+	c.JSON(p.Status, p)
+}
+
+// handleUnmatched answers requests no route matches with 404, and those
+// whose path is routed for other methods only with 405 and an Allow
+// header. tmpl is the engine's template set, nil without one.
+func handleUnmatched(engine *gin.Engine, tmpl *template.Template) {
+	engine.HandleMethodNotAllowed = true
+	engine.NoRoute(func(c *gin.Context) {
+		p := newProblem(c, http.StatusNotFound, fmt.Sprintf("No route for %s %s.", c.Request.Method, c.Request.URL.Path))
+		p.Suggestion = closestRoute(engine.Routes(), c.Request.Method, c.Request.URL.Path)
+		writeProblem(c, tmpl, p)
+	})
+	engine.NoMethod(func(c *gin.Context) {
+		p := newProblem(c, http.StatusMethodNotAllowed, fmt.Sprintf("%s does not support %s.", c.Request.URL.Path, c.Request.Method))
+		p.Allow = allowedMethods(engine.Routes(), c.Request.URL.Path)
+		c.Header("Allow", strings.Join(p.Allow, ", "))
+		writeProblem(c, tmpl, p)
+	})
+}
+
+// allowedMethods lists the methods with a route matching path.
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, r := range routes {
+		if !seen[r.Method] && matchRoute(r.Path, path) {
+			seen[r.Method] = true
+			methods = append(methods, r.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute reports whether the route pattern matches path.
+func matchRoute(pattern, path string) bool {
+	_, ok := fillRoute(pattern, path)
+	return ok
+}
+
+// fillRoute puts the segments of path into the parameters of pattern. It
+// reports whether the result is path itself.
+func fillRoute(pattern, path string) (string, bool) {
+	want, have := pathSegments(pattern), pathSegments(path)
+	filled := make([]string, 0, len(want))
+	for i, s := range want {
+		switch {
+		case isCatchAll(s):
+			filled = append(filled, have[minInt(i, len(have)):]...)
+			result := "/" + strings.Join(filled, "/")
+			return result, result == path && len(have) > i
+		case isParam(s) && i < len(have) && have[i] != "":
+			filled = append(filled, have[i])
+		default:
+			filled = append(filled, s)
+		}
+	}
+	result := "/" + strings.Join(filled, "/")
+	return result, result == path
+}
+
+// maxSuggestPath is the longest path closestRoute looks at; longer ones are
+// no typos.
+const maxSuggestPath = 256
+
+// closestRoute suggests the route of method a few typos away from path,
+// filled with the segments of path, or "" when none is that close.
+func closestRoute(routes gin.RoutesInfo, method, path string) string {
+	if len(path) > maxSuggestPath {
+		return ""
+	}
+	best, bestDistance := "", 4
+	for _, r := range routes {
+		if r.Method != method {
+			continue
+		}
+		candidate, filled, compared := suggestRoute(r.Path, path)
+		if d := editDistance(strings.ToLower(filled), strings.ToLower(compared), bestDistance-1); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// suggestRoute fills the parameters of pattern with the segments of path
+// for closestRoute, and returns the filled part with the part of path to
+// compare it to. A catch-all is kept as it is: only the segments before it
+// are compared, so the rest of path is neither copied nor measured.
+func suggestRoute(pattern, path string) (candidate, filled, compared string) {
+	want, have := pathSegments(pattern), pathSegments(path)
+	last := want[len(want)-1]
+	if !isCatchAll(last) {
+		candidate, _ = fillRoute(pattern, path)
+		return candidate, candidate, path
+	}
+	n := minInt(len(want)-1, len(have))
+	compared = "/" + strings.Join(have[:n], "/")
+	filled, _ = fillRoute("/"+strings.Join(want[:len(want)-1], "/"), compared)
+	return strings.TrimSuffix(filled, "/") + "/" + last, filled, compared
+}
+
+// editDistance is the Levenshtein distance of a and b, or max+1 once it is
+// known to be over max.
+func editDistance(a, b string, max int) int {
+	if len(a)-len(b) > max || len(b)-len(a) > max {
+		return max + 1
+	}
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		lowest := i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+			lowest = minInt(lowest, cur[j])
+		}
+		if lowest > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return minInt(prev[len(b)], max+1)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
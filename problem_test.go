@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmatched(t *testing.T) {
+	deps := testDeps()
+	router := NewRouter(deps)
+
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/someJSOM", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	var p problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "/someJSON", p.Suggestion)
+	assert.Equal(t, w.Header().Get(requestIDHeader), p.RequestID)
+
+	w = perform(router, httptest.NewRequest(http.MethodGet, "/loginJSON", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+
+	w = perform(router, httptest.NewRequest(http.MethodDelete, "/user/john", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+
+	req := httptest.NewRequest(http.MethodGet, "/a/b/c/d", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	w = perform(router, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "<h1>404 Not Found</h1>")
+
+	for _, e := range []*gin.Engine{router8081(deps.Config, deps.Templates), router8082(deps.Config, nil)} {
+		w = perform(e, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET", w.Header().Get("Allow"))
+		assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestClosestRoute(t *testing.T) {
+	routes := NewRouter(testDeps()).Routes()
+	assert.Equal(t, "/admin/log/level", closestRoute(routes, http.MethodGet, "/admin/log/levle"))
+	assert.Equal(t, "/user/john/*action", closestRoute(routes, http.MethodPost, "/usr/john/send"))
+	assert.Equal(t, "/loginJSON", closestRoute(routes, http.MethodPost, "/loginJson"))
+	assert.Empty(t, closestRoute(routes, http.MethodGet, "/something/else/entirely/here"))
+
+	// Catch-alls are not filled with the rest of the path, and long paths
+	// get no suggestion at all.
+	rest := strings.Repeat("x", 200)
+	assert.Equal(t, "/user/john/*action", closestRoute(routes, http.MethodPost, "/usr/john/"+rest))
+	assert.Empty(t, closestRoute(routes, http.MethodPost, "/usr/john/"+strings.Repeat(rest+"/", 50)))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("level", "level", 3))
+	assert.Equal(t, 2, editDistance("levle", "level", 3), "transposition is two edits")
+	assert.Equal(t, 4, editDistance("a", "abcdefgh", 3))
+	assert.Equal(t, 4, editDistance("abcdefgh", "hgfedcba", 3))
+}
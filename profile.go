@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Profile bundles the settings that differ between a dev, test and
+// release run. It is picked by name with -profile or GIN_DEMO_PROFILE.
+type Profile struct {
+	GinMode string
+	// Color is "force", "disable" or empty to let gin detect a terminal.
+	Color string
+	// PrintRoutes logs every route while the engines are built.
+	PrintRoutes bool
+	// RecoveryStack logs the stack trace of a recovered panic,
+	// RecoveryDetails also returns the panic value to the client.
+	RecoveryStack   bool
+	RecoveryDetails bool
+	// Stdout and File choose where gin.DefaultWriter goes. File only
+	// applies when log.file is set.
+	Stdout bool
+	File   bool
+}
+
+var profiles = map[string]Profile{
+	"dev": {
+		GinMode:         gin.DebugMode,
+		Color:           "force",
+		PrintRoutes:     true,
+		RecoveryStack:   true,
+		RecoveryDetails: true,
+		Stdout:          true,
+		File:            true,
+	},
+	"test": {
+		GinMode:         gin.TestMode,
+		Color:           "disable",
+		RecoveryDetails: true,
+	},
+	"release": {
+		GinMode:       gin.ReleaseMode,
+		Color:         "disable",
+		RecoveryStack: true,
+		Stdout:        true,
+		File:          true,
+	},
+}
+
+// profile returns the Profile named by c.Profile.
+func (c *Config) profile() Profile {
+	return profiles[c.Profile]
+}
+
+// logFileConfig is the log file to open, without file when the profile
+// has none.
+func (c *Config) logFileConfig() LogConfig {
+	lc := c.Log
+	if !c.profile().File {
+		lc.File = ""
+	}
+	return lc
+}
+
+// applyProfile sets gin's global mode, colors and route printing.
+// It must run before any engine is created.
+func applyProfile(p Profile) {
+	gin.SetMode(p.GinMode)
+	switch p.Color {
+	case "force":
+		gin.ForceConsoleColor()
+	case "disable":
+		gin.DisableConsoleColor()
+	}
+
+	if p.PrintRoutes {
+		// Define format for the log of routes
+		gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+			log.Printf("endpoint %v %v %v %v\n", httpMethod, absolutePath, handlerName, nuHandlers)
+		}
+	} else {
+		gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {}
+	}
+}
+
+// logWriter combines the profile's log destinations, console being stdout
+// or stderr. The file never gets color codes, even when they are forced.
+func logWriter(p Profile, file, console io.Writer) io.Writer {
+	var writers []io.Writer
+	if p.File {
+		writers = append(writers, ansiStripper{file})
+	}
+	if p.Stdout {
+		writers = append(writers, console)
+	}
+	if len(writers) == 0 {
+		return io.Discard
+	}
+	return io.MultiWriter(writers...)
+}
+
+// ansiEscape matches the SGR color sequences gin writes.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ansiStripper removes color codes before writing to w.
+type ansiStripper struct {
+	w io.Writer
+}
+
+func (a ansiStripper) Write(p []byte) (int, error) {
+	if _, err := a.w.Write(ansiEscape.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// recovery is the Custom Recovery behavior of the engines. Unlike
+// gin.CustomRecoveryWithWriter it redacts the request dump with red.
+func recovery(p Profile, logger *Logger, red *redactor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			logger := logger.For(c)
+
+			// A broken connection is not worth a stack trace, and there is
+			// no one left to send a status to.
+			if err, ok := recovered.(error); ok && brokenPipe(err) {
+				logger.Warnf("connection lost: %v", err)
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			logger.Errorf("panic recovered: %v", recovered)
+			if p.RecoveryStack {
+				fmt.Fprintf(gin.DefaultErrorWriter, "[Recovery] %s panic recovered:\n%s\n%v\n%s\n",
+					time.Now().Format("2006/01/02 - 15:04:05"), red.DumpRequest(c.Request), recovered, debug.Stack())
+			}
+			if p.RecoveryDetails {
+				c.String(http.StatusInternalServerError, fmt.Sprintf("error: %v", recovered))
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+func brokenPipe(err error) bool {
+	var se *os.SyscallError
+	if !errors.As(err, &se) {
+		return false
+	}
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
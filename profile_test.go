@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnsiStripper(t *testing.T) {
+	var file, console bytes.Buffer
+	w := logWriter(profiles["dev"], &file, &console)
+
+	io.WriteString(w, "[GIN] |\x1b[97;42m 200 \x1b[0m| GET\n")
+	assert.Equal(t, "[GIN] | 200 | GET\n", file.String())
+	assert.Contains(t, console.String(), "\x1b[97;42m")
+}
+
+func TestTestProfileDiscardsLogs(t *testing.T) {
+	var file, console bytes.Buffer
+	w := logWriter(profiles["test"], &file, &console)
+
+	io.WriteString(w, "hello\n")
+	assert.Zero(t, file.Len())
+	assert.Zero(t, console.Len())
+}
+
+func TestRecoveryDetails(t *testing.T) {
+	for name, want := range map[string]string{
+		"dev":     "error: foo",
+		"release": "",
+	} {
+		deps := testDeps()
+		deps.Config.Profile = name
+		deps.Logger = log.New(io.Discard, "", 0)
+		router := NewRouter(deps)
+
+		w := perform(router, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, name)
+		assert.Equal(t, want, w.Body.String(), name)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticatedRole is held by every principal, on top of its own roles.
+const authenticatedRole = "authenticated"
+
+// The sources of principals. The rbac policy knows subjects as source and
+// name, like "user:manu", so anyone registering a login user named like a
+// token subject or admin account gets none of its roles.
+const (
+	// sourceToken are the subjects of the token store.
+	sourceToken = "token"
+	// sourceUser are the login users, authenticated by their access tokens.
+	sourceUser = "user"
+	// sourceAdmin are the admin accounts.
+	sourceAdmin = "admin"
+)
+
+// principalSources are the sources rbac.subjects may name.
+var principalSources = map[string]bool{sourceToken: true, sourceUser: true, sourceAdmin: true}
+
+// rbacPolicy grants permissions to principals through their roles, as set
+// up by the rbac config. A "*" permission grants every permission.
+type rbacPolicy struct {
+	roles    map[string][]string
+	subjects map[string][]string
+}
+
+func newRBACPolicy(cfg RBACConfig) *rbacPolicy {
+	return &rbacPolicy{roles: cfg.Roles, subjects: cfg.Subjects}
+}
+
+// attach sets the roles and permissions of p's source and subject.
+func (pol *rbacPolicy) attach(p Principal) Principal {
+	p.Roles = append([]string{authenticatedRole}, pol.subjects[p.Source+":"+p.Subject]...)
+	seen := map[string]bool{}
+	p.Permissions = nil
+	for _, role := range p.Roles {
+		for _, perm := range pol.roles[role] {
+			if !seen[perm] {
+				seen[perm] = true
+				p.Permissions = append(p.Permissions, perm)
+			}
+		}
+	}
+	sort.Strings(p.Permissions)
+	return p
+}
+
+// HasPermission reports whether the roles of p grant perm. Token scopes
+// narrow that further: a principal with scopes needs perm among them too.
+func (p Principal) HasPermission(perm string) bool {
+	if p.Scopes != nil && !p.HasScope(perm) {
+		return false
+	}
+	for _, granted := range p.Permissions {
+		if granted == perm || granted == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Require lets requests through whose Principal has perm and answers the
+// others with a 403 problem naming it. It goes on groups or routes behind
+// authentication, which refuses routes without one, see permissionDeclared.
+func Require(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, _ := principalFrom(c)
+		if !p.HasPermission(perm) {
+			if p.Scopes != nil && !p.HasScope(perm) {
+				c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, perm))
+			}
+			prob := newProblem(c, http.StatusForbidden, fmt.Sprintf("The %s permission is required.", perm))
+			prob.Permission = perm
+			abortProblem(c, prob)
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireName is the function name of the handlers Require returns.
+var requireName = funcName(Require(""))
+
+// permissionDeclared reports whether a chain of handler names has a
+// Require.
+func permissionDeclared(handlers []string) bool {
+	for _, name := range handlers {
+		if name == requireName {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize finishes authentication middleware: it attaches the roles of
+// p and stores it, or denies routes that declare no permission.
+func authorize(c *gin.Context, policy *rbacPolicy, p Principal) bool {
+	if !permissionDeclared(c.HandlerNames()) {
+		abortProblem(c, newProblem(c, http.StatusForbidden, "The route declares no permission and is denied by default."))
+		return false
+	}
+	c.Set(principalKey, policy.attach(p))
+	c.Set(gin.AuthUserKey, p.Subject)
+	return true
+}
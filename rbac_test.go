@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequire(t *testing.T) {
+	deps := testDeps()
+	deps.Config.RBAC.Subjects["admin:austin"] = nil
+	router := NewRouter(deps)
+	bearer := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"message": "hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return perform(router, req)
+	}
+	basic := func(user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/secrets", nil)
+		req.SetBasicAuth(user, password)
+		return perform(router, req)
+	}
+
+	w := bearer(http.MethodPost, "/submit", "reader")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	var p problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "messages:write", p.Permission)
+	assert.Equal(t, "The messages:write permission is required.", p.Detail)
+
+	// The testing group requires analytics:read for all its routes.
+	w = bearer(http.MethodGet, "/testing/analytics", "okay")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"roles":["authenticated","writer","analyst"]`)
+	assert.Contains(t, bearer(http.MethodGet, "/testing/analytics", "reader").Body.String(), `"permission":"analytics:read"`)
+
+	// Admin accounts need a role too.
+	assert.Equal(t, http.StatusOK, basic("foo", "bar").Code)
+	w = basic("austin", "1234")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"permission":"admin:secrets"`)
+}
+
+func TestDenyByDefault(t *testing.T) {
+	deps := testDeps()
+	e := gin.New()
+	e.Use(routeProbe())
+	protected := e.Group("/", tokenAuth(deps, nil))
+	protected.GET("/open", func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.GET("/guarded", Require("ping"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer okay")
+		return perform(e, req)
+	}
+	w := get("/open")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "denied by default")
+	assert.Equal(t, http.StatusOK, get("/guarded").Code)
+
+	var lines []string
+	for _, p := range lintEngine("main", e) {
+		lines = append(lines, p.String())
+	}
+	assert.Equal(t, []string{"main GET /open: denied: authenticated without a Require, every request is denied"}, lines)
+}
+
+func TestPermissions(t *testing.T) {
+	policy := newRBACPolicy(RBACConfig{
+		Roles:    map[string][]string{authenticatedRole: {"ping"}, "root": {"*"}, "reader": {"messages:read"}},
+		Subjects: map[string][]string{"token:ada": {"root"}, "user:bob": {"reader"}},
+	})
+
+	ada := policy.attach(Principal{Source: sourceToken, Subject: "ada"})
+	assert.True(t, ada.HasPermission("anything"))
+	bob := policy.attach(Principal{Source: sourceUser, Subject: "bob"})
+	assert.Equal(t, []string{"authenticated", "reader"}, bob.Roles)
+	assert.Equal(t, []string{"messages:read", "ping"}, bob.Permissions)
+	assert.False(t, bob.HasPermission("messages:write"))
+	nobody := policy.attach(Principal{Source: sourceUser, Subject: "nobody"})
+	assert.True(t, nobody.HasPermission("ping"))
+	assert.False(t, nobody.HasPermission("messages:read"))
+	// Subjects only match within their source.
+	assert.False(t, policy.attach(Principal{Source: sourceUser, Subject: "ada"}).HasPermission("anything"))
+
+	// Token scopes narrow what the roles grant.
+	scoped := policy.attach(Principal{Source: sourceToken, Subject: "ada", Scopes: []string{"ping"}})
+	assert.True(t, scoped.HasPermission("ping"))
+	assert.False(t, scoped.HasPermission("messages:read"))
+
+	cfg := DefaultConfig()
+	cfg.RBAC.Subjects["user:ada"] = []string{"wizard"}
+	assert.ErrorContains(t, cfg.Validate(), `rbac.subjects.user:ada: unknown role "wizard"`)
+	cfg = DefaultConfig()
+	cfg.RBAC.Subjects["ada"] = []string{"reader"}
+	assert.ErrorContains(t, cfg.Validate(), "rbac.subjects.ada: want token:, user: or admin: and a name")
+}
+
+func TestRegisteredNamesGetNoRoles(t *testing.T) {
+	router := NewRouter(testDeps())
+	post := func(path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return perform(router, req)
+	}
+
+	// demo is a token subject with the writer role, not a login user.
+	assert.Equal(t, http.StatusCreated, post("/register", `{"user": "demo", "password": "password"}`, "").Code)
+	w := post("/loginJSON", `{"user": "demo", "password": "password"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var pair tokenPair
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	w = post("/submit", `{"message": "hi"}`, pair.AccessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"permission":"messages:write"`)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// redactor masks the denylisted headers, parameters and cookies of
+// RedactConfig before they are logged.
+type redactor struct {
+	headers, params, cookies map[string]bool
+}
+
+func newRedactor(cfg RedactConfig) *redactor {
+	set := func(names []string) map[string]bool {
+		m := make(map[string]bool, len(names))
+		for _, n := range names {
+			m[strings.ToLower(n)] = true
+		}
+		return m
+	}
+	return &redactor{
+		headers: set(cfg.Headers),
+		params:  set(cfg.Params),
+		cookies: set(cfg.Cookies),
+	}
+}
+
+// redactor returns the redactor of the log settings.
+func (c *Config) redactor() *redactor {
+	return newRedactor(c.Log.Redact)
+}
+
+// Param returns value, or the mask if name is a denylisted parameter.
+func (r *redactor) Param(name, value string) string {
+	if r.params[strings.ToLower(name)] {
+		return secretMask
+	}
+	return value
+}
+
+// Cookie returns value, or the mask if name is a denylisted cookie.
+func (r *redactor) Cookie(name, value string) string {
+	if r.cookies[strings.ToLower(name)] {
+		return secretMask
+	}
+	return value
+}
+
+// Query masks the denylisted parameters of a raw query, keeping the order
+// and encoding of the others.
+func (r *redactor) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil && r.params[strings.ToLower(name)] {
+			parts[i] = key + "=" + url.QueryEscape(secretMask)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Values returns a copy of v with the denylisted parameters masked.
+func (r *redactor) Values(v map[string]string) map[string]string {
+	out := make(map[string]string, len(v))
+	for k, val := range v {
+		out[k] = r.Param(k, val)
+	}
+	return out
+}
+
+// Header returns a copy of h with the denylisted headers masked and the
+// denylisted cookies removed from Cookie and Set-Cookie.
+func (r *redactor) Header(h http.Header) http.Header {
+	out := h.Clone()
+	for name := range out {
+		if r.headers[strings.ToLower(name)] {
+			out[name] = []string{secretMask}
+		}
+	}
+	for i, line := range out["Cookie"] {
+		var cookies []string
+		for _, c := range strings.Split(line, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(c), "=")
+			cookies = append(cookies, name+"="+r.Cookie(name, value))
+		}
+		out["Cookie"][i] = strings.Join(cookies, "; ")
+	}
+	for i, line := range out["Set-Cookie"] {
+		name, rest, _ := strings.Cut(line, "=")
+		if r.cookies[strings.ToLower(strings.TrimSpace(name))] {
+			_, attrs, _ := strings.Cut(rest, ";")
+			out["Set-Cookie"][i] = name + "=" + secretMask + ";" + attrs
+		}
+	}
+	return out
+}
+
+// DumpRequest is httputil.DumpRequest without the body and with headers
+// and query redacted.
+func (r *redactor) DumpRequest(req *http.Request) string {
+	clone := req.Clone(req.Context())
+	clone.Header = r.Header(req.Header)
+	u := *req.URL
+	u.RawQuery = r.Query(u.RawQuery)
+	clone.URL = &u
+	clone.RequestURI = ""
+	b, _ := httputil.DumpRequest(clone, false)
+	return string(b)
+}
+
+// redactValue returns a copy of v with the fields tagged `log:"redact"`
+// masked, following nested structs and pointers. Use it before printing
+// bound request structs.
+func redactValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return redactCopy(reflect.ValueOf(v)).Interface()
+}
+
+func redactCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(redactCopy(v.Elem()))
+		return p
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := out.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if v.Type().Field(i).Tag.Get("log") != "redact" {
+				field.Set(redactCopy(v.Field(i)))
+			} else if field.Kind() == reflect.String {
+				field.SetString(secretMask)
+			} else {
+				field.Set(reflect.Zero(field.Type()))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// bindError is the message shown for a binding error. Validation errors
+// only name fields and rules; other errors may quote the rejected input,
+// so they are replaced by a generic message.
+func bindError(err error) string {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		return verrs.Error()
+	}
+	return "malformed request"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactQueryAndHeader(t *testing.T) {
+	red := DefaultConfig().redactor()
+
+	assert.Equal(t, "user=foo&Password=%5BREDACTED%5D&x", red.Query("user=foo&Password=s3cret&x"))
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	h.Set("Cookie", "gin_cookie=test; theme=dark")
+	h.Set("Set-Cookie", "gin_cookie=test; Path=/; HttpOnly")
+	h.Set("Accept", "text/html")
+	out := red.Header(h)
+	assert.Equal(t, secretMask, out.Get("Authorization"))
+	assert.Equal(t, "gin_cookie=[REDACTED]; theme=dark", out.Get("Cookie"))
+	assert.Equal(t, "gin_cookie=[REDACTED]; Path=/; HttpOnly", out.Get("Set-Cookie"))
+	assert.Equal(t, "text/html", out.Get("Accept"))
+	assert.Equal(t, "Bearer abc", h.Get("Authorization"), "input is left alone")
+}
+
+func TestRedactValue(t *testing.T) {
+	type wrapper struct {
+		Login *Login
+		Note  string
+	}
+	in := wrapper{Login: &Login{User: "manu", Password: "123"}, Note: "hi"}
+
+	out := fmt.Sprintf("%+v", redactValue(in).(wrapper).Login)
+	assert.Equal(t, "&{User:manu Password:[REDACTED]}", out)
+	assert.Equal(t, "123", in.Login.Password, "input is left alone")
+	assert.Equal(t, "hi", redactValue(in).(wrapper).Note)
+}
+
+func TestBindErrorHidesInput(t *testing.T) {
+	router := NewRouter(testDeps())
+
+	req := httptest.NewRequest(http.MethodPost, "/loginJSON", bytes.NewBufferString(`{"user": "manu"}`))
+	w := perform(router, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Login.Password")
+
+	assert.Equal(t, "malformed request", bindError(errors.New(`parsing time "s3cret"`)))
+}
+
+func TestRedactedLogs(t *testing.T) {
+	var access, stack bytes.Buffer
+	errWriter := gin.DefaultErrorWriter
+	gin.DefaultErrorWriter = &stack
+	defer func() { gin.DefaultErrorWriter = errWriter }()
+
+	red := DefaultConfig().redactor()
+	router := gin.New()
+	router.Use(accessLog(&access, DefaultConfig().Log, "json"), recovery(profiles["dev"], newLogger("http", log.New(io.Discard, "", 0)), red))
+	router.GET("/panic", func(c *gin.Context) { panic("foo") })
+
+	req := httptest.NewRequest(http.MethodGet, "/panic?token=tok3n&page=2", nil)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	req.AddCookie(&http.Cookie{Name: "gin_cookie", Value: "s3cret"})
+	perform(router, req)
+
+	var entry accessLogEntry
+	assert.NoError(t, json.Unmarshal(access.Bytes(), &entry))
+	assert.Equal(t, "token=%5BREDACTED%5D&page=2", entry.Query)
+
+	assert.Contains(t, stack.String(), "panic recovered")
+	assert.Contains(t, stack.String(), "gin_cookie=[REDACTED]")
+	for _, leak := range []string{"tok3n", "Zm9vOmJhcg==", "s3cret"} {
+		assert.NotContains(t, stack.String(), leak)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// swapHandler serves through a handler that can be replaced at runtime.
+// Requests in flight finish on the handler they started with.
+type swapHandler struct {
+	v atomic.Value
+}
+
+// handlerBox keeps the concrete type stored in swapHandler.v constant.
+type handlerBox struct {
+	http.Handler
+}
+
+func newSwapHandler(h http.Handler) *swapHandler {
+	s := &swapHandler{}
+	s.Swap(h)
+	return s
+}
+
+func (s *swapHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.v.Load().(handlerBox).ServeHTTP(w, req)
+}
+
+func (s *swapHandler) Swap(h http.Handler) {
+	s.v.Store(handlerBox{h})
+}
+
+// reloader rebuilds the engines of all three servers from a freshly loaded
+// config. Listeners stay open, so reloading never drops a connection.
+type reloader struct {
+	load         func() (*Config, error)
+	singleBinary bool
+	logFile      *logFile
+
+	mu  sync.Mutex
+	cfg *Config
+	rdb *redis.Client
+	// users survives reloads, so the memory store keeps its registrations.
+	users UserStore
+	// lockouts survives reloads, so a SIGHUP unlocks no admin account.
+	lockouts *lockouts
+
+	main, server01, server02 *swapHandler
+}
+
+func newReloader(cfg *Config, load func() (*Config, error), singleBinary bool, logFile *logFile) (*reloader, error) {
+	secrets, err := newSecretProvider(cfg.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := redisOptions(cfg.Redis, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reloader{
+		load:         load,
+		singleBinary: singleBinary,
+		logFile:      logFile,
+		cfg:          cfg,
+		rdb:          newRedisClient(opts),
+		lockouts:     newLockouts(),
+	}
+	r.users, err = r.userStore(cfg, r.rdb, secrets)
+	if err != nil {
+		return nil, err
+	}
+	main, server01, server02, err := r.build(cfg, r.rdb, secrets, r.users)
+	if err != nil {
+		return nil, err
+	}
+	r.main = newSwapHandler(main)
+	r.server01 = newSwapHandler(server01)
+	r.server02 = newSwapHandler(server02)
+	return r, nil
+}
+
+// userStore returns the running user store while the users section of cfg
+// is unchanged, and a new one otherwise. Redis stores are always renewed,
+// they hold nothing but the client.
+func (r *reloader) userStore(cfg *Config, rdb redis.Cmdable, secrets SecretProvider) (UserStore, error) {
+	if r.users != nil && cfg.Users == r.cfg.Users && cfg.Users.Store != "redis" {
+		return r.users, nil
+	}
+	return newUserStore(cfg.Users, rdb, secrets, time.Now())
+}
+
+func (r *reloader) build(cfg *Config, rdb *redis.Client, secrets SecretProvider, users UserStore) (main, server01, server02 http.Handler, err error) {
+	if r.singleBinary {
+		main, err = BuildMain()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Without the template files the error pages are JSON only.
+		return main, router8081(cfg, nil), router8082(cfg, nil), nil
+	}
+
+	deps, err := newDeps(cfg, rdb, secrets, users)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	deps.Lockouts = r.lockouts
+	// The main engine serves /debug/routes for all three.
+	deps.Routes = &routeIndex{}
+	main = NewRouter(deps)
+	s1, s2 := router8081(cfg, deps.Templates), router8082(cfg, deps.Templates)
+	deps.Routes.addEngine("server01", s1)
+	deps.Routes.addEngine("server02", s2)
+	return main, s1, s2, nil
+}
+
+// Reload re-reads the config and secrets, re-parses the templates, rebuilds
+// the engines (BasicAuth accounts, trusted proxies) and reopens the log file. On error
+// the running state is left untouched.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		return err
+	}
+	if listeners(cfg.Servers) != listeners(r.cfg.Servers) {
+		stdLogger("reload").Warnf("servers settings changed, restart to apply them")
+	}
+	if cfg.Profile != r.cfg.Profile {
+		stdLogger("reload").Warnf("profile changed, restart to apply it")
+		cfg.Profile = r.cfg.Profile
+	}
+
+	// Secrets are resolved again, so rotated ones take effect.
+	secrets, err := newSecretProvider(cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	opts, err := redisOptions(cfg.Redis, secrets)
+	if err != nil {
+		return err
+	}
+	rdb := r.rdb
+	if cur := rdb.Options(); opts.Addr != cur.Addr || opts.Password != cur.Password || opts.DB != cur.DB {
+		rdb = newRedisClient(opts)
+	}
+	users, err := r.userStore(cfg, rdb, secrets)
+	var main, server01, server02 http.Handler
+	if err == nil {
+		main, server01, server02, err = r.build(cfg, rdb, secrets, users)
+	}
+	if err == nil {
+		err = r.logFile.Reopen(cfg.logFileConfig())
+	}
+	if err == nil {
+		defaultLevels.Configure(cfg.Log)
+	}
+	if err != nil {
+		if rdb != r.rdb {
+			rdb.Close()
+		}
+		return err
+	}
+
+	r.main.Swap(main)
+	r.server01.Swap(server01)
+	r.server02.Swap(server02)
+
+	if rdb != r.rdb {
+		// Give requests still using the old client time to finish.
+		old := r.rdb
+		time.AfterFunc(r.cfg.Servers.ShutdownTimeout, func() { old.Close() })
+	}
+	r.cfg, r.rdb, r.users = cfg, rdb, users
+	return nil
+}
+
+// listeners returns s without the settings a reload applies, leaving
+// those that need a restart.
+func listeners(s ServersConfig) ServersConfig {
+	s.Main.AccessLog, s.Server01.AccessLog, s.Server02.AccessLog = "", "", ""
+	return s
+}
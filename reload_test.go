@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadRotatesAccounts(t *testing.T) {
+	t.Setenv("GIN_DEMO_SECRET_ADMIN_ACCOUNTS", "foo:{SHA}Ys23Ag/5IOWqZCw9QGaVDdHwH00=")
+	cfg := DefaultConfig()
+	cfg.Log.File = filepath.Join(t.TempDir(), "gin.log")
+	cfg.Secrets.Providers = []string{"env"}
+	cfg.Users.SeedSecret = ""
+	cfg.RBAC.Subjects["admin:foo"] = []string{"operator"}
+
+	var loadErr error
+	load := func() (*Config, error) { return cfg, loadErr }
+
+	lf := &logFile{}
+	defer lf.Reopen(LogConfig{})
+	r, err := newReloader(cfg, load, false, lf)
+	assert.NoError(t, err)
+
+	status := func(password string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/secrets", nil)
+		req.SetBasicAuth("foo", password)
+		w := httptest.NewRecorder()
+		r.main.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, status("bar"))
+
+	// Rotated secrets take effect on reload.
+	t.Setenv("GIN_DEMO_SECRET_ADMIN_ACCOUNTS", "foo:{SHA}tj9vGhn7EbdIiWOsEW4MX0OI6Fs=")
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, http.StatusUnauthorized, status("bar"))
+	assert.Equal(t, http.StatusOK, status("rotated"))
+
+	// A failing reload keeps the running engines.
+	loadErr = errors.New("broken config")
+	assert.Error(t, r.Reload())
+	assert.Equal(t, http.StatusOK, status("rotated"))
+	loadErr = nil
+
+	// Reloads keep lockouts.
+	for i := 0; i < cfg.Admin.MaxFailures; i++ {
+		assert.Equal(t, http.StatusUnauthorized, status("wrong"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status("rotated"))
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, http.StatusTooManyRequests, status("rotated"))
+}
+
+func TestReloadKeepsUsers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Log.File = filepath.Join(t.TempDir(), "gin.log")
+	cfg.Secrets.Providers = []string{"env"}
+	cfg.Users.SeedSecret = ""
+	next := *cfg
+	load := func() (*Config, error) { c := next; return &c, nil }
+
+	lf := &logFile{}
+	defer lf.Reopen(LogConfig{})
+	r, err := newReloader(cfg, load, false, lf)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, r.users.Create(ctx, User{Name: "new", PasswordHash: "$2a$04$x"}))
+	assert.NoError(t, r.Reload())
+	_, err = r.users.User(ctx, "new")
+	assert.NoError(t, err)
+
+	// A changed users section starts over.
+	next.Users.Hash = "argon2id"
+	assert.NoError(t, r.Reload())
+	_, err = r.users.User(ctx, "new")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
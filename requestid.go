@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	// requestIDHeader is accepted from clients and echoed in every response.
+	requestIDHeader = "X-Request-ID"
+	// requestIDKey holds the ID in the gin context.
+	requestIDKey = "request_id"
+)
+
+type requestIDContextKey struct{}
+
+// withRequestID returns a copy of ctx carrying id.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// requestIDFrom returns the request ID carried by ctx, which may be a
+// *gin.Context or its copy, or "" if there is none.
+func requestIDFrom(ctx context.Context) string {
+	if c, ok := ctx.(*gin.Context); ok {
+		if id := c.GetString(requestIDKey); id != "" || c.Request == nil {
+			return id
+		}
+		ctx = c.Request.Context()
+	}
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestID tags each request with the client's X-Request-ID, or a new one
+// when it is missing or malformed. The ID is stored in the gin context and
+// the request's context.Context and sent back in the response.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID keeps client supplied IDs short and safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// redisLogHook logs failed Redis commands with the request ID of their
+// context.
+type redisLogHook struct {
+	logger *Logger
+}
+
+func (h redisLogHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisLogHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		h.logger.For(ctx).Errorf("%s: %v", cmd.Name(), err)
+	}
+	return nil
+}
+
+func (h redisLogHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisLogHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.AfterProcess(ctx, cmd)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var access, logs bytes.Buffer
+	logger := newLogger("test", log.New(&logs, "", 0))
+	done := make(chan struct{})
+
+	router := gin.New()
+	router.Use(requestID(), accessLog(&access, DefaultConfig().Log, "json"))
+	router.GET("/async", func(c *gin.Context) {
+		cCp := c.Copy()
+		go func() {
+			logger.For(cCp).Infof("done")
+			close(done)
+		}()
+		assert.Equal(t, requestIDFrom(c), requestIDFrom(c.Request.Context()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/async", nil)
+	req.Header.Set(requestIDHeader, "abc-123")
+	w := perform(router, req)
+	<-done
+
+	assert.Equal(t, "abc-123", w.Header().Get(requestIDHeader))
+	assert.Equal(t, "INFO test: request_id=abc-123 done\n", logs.String())
+	var entry accessLogEntry
+	assert.NoError(t, json.Unmarshal(access.Bytes(), &entry))
+	assert.Equal(t, "abc-123", entry.RequestID)
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	router := gin.New()
+	router.Use(requestID())
+	router.GET("/", func(c *gin.Context) {})
+
+	w := perform(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, w.Header().Get(requestIDHeader), 32)
+
+	// Malformed IDs are replaced rather than logged.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	w = perform(router, req)
+	assert.Len(t, w.Header().Get(requestIDHeader), 32)
+}
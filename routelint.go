@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeProblem is something the route linter found wrong with a route.
+type routeProblem struct {
+	// Kind is conflict, nil-handler, duplicate, unreachable, shadowed,
+	// ambiguous or denied.
+	Kind   string `json:"kind"`
+	Server string `json:"server"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Other is the route the problem is with, if any.
+	Other string `json:"other,omitempty"`
+	// Detail explains the problem, with an example request where there is
+	// one.
+	Detail string `json:"detail"`
+}
+
+// String is the problem as listed in the baseline file.
+func (p routeProblem) String() string {
+	return fmt.Sprintf("%s %s %s: %s: %s", p.Server, p.Method, p.Path, p.Kind, p.Detail)
+}
+
+// lintRoutes builds every engine and reports its route problems, sorted.
+// An engine gin refuses to build, because two routes conflict or one is
+// registered twice, is reported as a single conflict.
+func lintRoutes(deps Deps) []routeProblem {
+	engines := []struct {
+		server string
+		build  func() *gin.Engine
+	}{
+		{"main", func() *gin.Engine { return NewRouter(deps) }},
+		{"server01", func() *gin.Engine { return router8081(deps.Config, deps.Templates) }},
+		{"server02", func() *gin.Engine { return router8082(deps.Config, deps.Templates) }},
+	}
+
+	var problems []routeProblem
+	for _, e := range engines {
+		engine, err := buildEngine(e.build)
+		if err != nil {
+			problems = append(problems, routeProblem{Kind: "conflict", Server: e.server, Detail: err.Error()})
+			continue
+		}
+		problems = append(problems, lintEngine(e.server, engine)...)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].String() < problems[j].String()
+	})
+	return problems
+}
+
+// buildEngine turns the panics of gin's route registration into an error.
+func buildEngine(build func() *gin.Engine) (engine *gin.Engine, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return build(), nil
+}
+
+// lintEngine checks the routes of one engine. Overlapping routes are sent
+// through the engine to see which one gin picks.
+func lintEngine(server string, engine *gin.Engine) []routeProblem {
+	var problems []routeProblem
+	byMethod := map[string][]gin.RouteInfo{}
+	for _, r := range engine.Routes() {
+		if r.HandlerFunc == nil {
+			problems = append(problems, routeProblem{Kind: "nil-handler", Server: server, Method: r.Method, Path: r.Path,
+				Detail: "no handler, requests panic"})
+		}
+		if chain, ok := probeRoute(engine, r.Method, r.Path); ok && authenticated(chain) && !permissionDeclared(chain) {
+			problems = append(problems, routeProblem{Kind: "denied", Server: server, Method: r.Method, Path: r.Path,
+				Detail: "authenticated without a Require, every request is denied"})
+		}
+		if example := samplePath(r.Path); probe(engine, r.Method, example).path != r.Path {
+			problems = append(problems, routeProblem{Kind: "unreachable", Server: server, Method: r.Method, Path: r.Path,
+				Detail: fmt.Sprintf("%s is served by %s", example, orNone(probe(engine, r.Method, example).path))})
+		}
+		byMethod[r.Method] = append(byMethod[r.Method], r)
+	}
+
+	for method, routes := range byMethod {
+		sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+		for i, a := range routes {
+			for _, b := range routes[i+1:] {
+				if strings.TrimSuffix(a.Path, "/") == strings.TrimSuffix(b.Path, "/") {
+					problems = append(problems, routeProblem{Kind: "duplicate", Server: server, Method: method, Path: a.Path, Other: b.Path,
+						Detail: "also registered as " + b.Path})
+					continue
+				}
+				segments, ok := overlap(pathSegments(a.Path), pathSegments(b.Path))
+				if !ok {
+					continue
+				}
+				example := "/" + strings.Join(segments, "/")
+				winner := probe(engine, method, example).path
+				p := routeProblem{Server: server, Method: method, Path: a.Path, Other: b.Path}
+				switch {
+				case winner == b.Path && covers(pathSegments(a.Path), pathSegments(b.Path)):
+					p.Kind = "shadowed"
+					p.Detail = fmt.Sprintf("%s wins for %s", b.Path, example)
+				case winner == a.Path && covers(pathSegments(b.Path), pathSegments(a.Path)):
+					p.Kind, p.Path, p.Other = "shadowed", b.Path, a.Path
+					p.Detail = fmt.Sprintf("%s wins for %s", a.Path, example)
+				default:
+					p.Kind = "ambiguous"
+					p.Detail = fmt.Sprintf("overlaps %s, %s is served by %s", b.Path, example, orNone(winner))
+				}
+				problems = append(problems, p)
+			}
+		}
+	}
+	return problems
+}
+
+// authenticated reports whether a chain of handler names has an auth
+// middleware.
+func authenticated(handlers []string) bool {
+	routeMeta.RLock()
+	defer routeMeta.RUnlock()
+	for _, name := range handlers {
+		if _, ok := routeMeta.auth[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func orNone(path string) string {
+	if path == "" {
+		return "no route"
+	}
+	return path
+}
+
+func pathSegments(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func isParam(segment string) bool    { return strings.HasPrefix(segment, ":") }
+func isCatchAll(segment string) bool { return strings.HasPrefix(segment, "*") }
+
+// overlap returns the segments of a path both patterns match, with
+// parameters filled in, or false when there is none. A catch-all matches
+// the rest of the path, nothing included.
+func overlap(a, b []string) ([]string, bool) {
+	var path []string
+	for i := 0; ; i++ {
+		switch {
+		case i < len(a) && isCatchAll(a[i]):
+			return append(path, fillSegments(b[i:])...), true
+		case i < len(b) && isCatchAll(b[i]):
+			return append(path, fillSegments(a[i:])...), true
+		case i == len(a) || i == len(b):
+			return path, len(a) == len(b)
+		}
+		switch x, y := a[i], b[i]; {
+		case isParam(x) && isParam(y):
+			path = append(path, "x")
+		case isParam(x):
+			path = append(path, y)
+		case isParam(y), x == y:
+			path = append(path, x)
+		default:
+			return nil, false
+		}
+	}
+}
+
+func fillSegments(segments []string) []string {
+	filled := make([]string, len(segments))
+	for i, s := range segments {
+		filled[i] = s
+		if isParam(s) || isCatchAll(s) {
+			filled[i] = "x"
+		}
+	}
+	return filled
+}
+
+// covers reports whether pattern a matches every path pattern b matches.
+func covers(a, b []string) bool {
+	for i := range a {
+		if isCatchAll(a[i]) {
+			return true
+		}
+		if i == len(b) || isCatchAll(b[i]) {
+			return false
+		}
+		if !isParam(a[i]) && (isParam(b[i]) || a[i] != b[i]) {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// readRouteBaseline reads the accepted problems, one per line as written by
+// routeProblem.String. Blank lines and lines starting with # are skipped;
+// a missing file accepts nothing.
+func readRouteBaseline(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	accepted := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			accepted[line] = true
+		}
+	}
+	return accepted, scanner.Err()
+}
+
+// writeRouteBaseline accepts every problem in problems.
+func writeRouteBaseline(w io.Writer, problems []routeProblem) error {
+	fmt.Fprintln(w, "# Accepted route problems, see gin-demo lint-routes.")
+	for _, p := range problems {
+		if _, err := fmt.Fprintln(w, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRouteProblems returns the problems the baseline doesn't accept.
+func newRouteProblems(problems []routeProblem, accepted map[string]bool) []routeProblem {
+	var fresh []routeProblem
+	for _, p := range problems {
+		if !accepted[p.String()] {
+			fresh = append(fresh, p)
+		}
+	}
+	return fresh
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertRouteLint fails t for every route problem of deps the baseline
+// file doesn't accept, like gin-demo lint-routes does in CI.
+func assertRouteLint(t *testing.T, deps Deps, baseline string) {
+	t.Helper()
+	accepted, err := readRouteBaseline(baseline)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, p := range newRouteProblems(lintRoutes(deps), accepted) {
+		t.Errorf("new route problem, fix it or run gin-demo lint-routes -update: %s", p)
+	}
+}
+
+func TestRoutesBaseline(t *testing.T) {
+	assertRouteLint(t, testDeps(), "routes.baseline")
+}
+
+func TestLintEngine(t *testing.T) {
+	ok := func(c *gin.Context) {}
+	e := gin.New()
+	e.Use(routeProbe())
+	e.GET("/user/:name", ok)
+	e.GET("/user/groups", ok)
+	e.GET("/:a/b", ok)
+	e.GET("/files", ok)
+	e.GET("/files/", ok)
+	e.POST("/submit", nil)
+
+	var lines []string
+	for _, p := range lintEngine("main", e) {
+		lines = append(lines, p.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"main GET /:a/b: ambiguous: overlaps /user/:name, /user/b is served by /user/:name",
+		"main GET /files: duplicate: also registered as /files/",
+		"main GET /user/:name: shadowed: /user/groups wins for /user/groups",
+		"main POST /submit: nil-handler: no handler, requests panic",
+	}, lines)
+
+	_, err := buildEngine(func() *gin.Engine {
+		e := gin.New()
+		e.GET("/user/:name", ok)
+		e.GET("/user/:id", ok)
+		return e
+	})
+	assert.Error(t, err)
+}
+
+func TestRouteBaseline(t *testing.T) {
+	problems := []routeProblem{
+		{Kind: "nil-handler", Server: "main", Method: http.MethodPost, Path: "/read", Detail: "no handler, requests panic"},
+		{Kind: "nil-handler", Server: "main", Method: http.MethodPost, Path: "/submit", Detail: "no handler, requests panic"},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, writeRouteBaseline(&buf, problems[:1]))
+	path := t.TempDir() + "/routes.baseline"
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	accepted, err := readRouteBaseline(path)
+	assert.NoError(t, err)
+	assert.Equal(t, problems[1:], newRouteProblems(problems, accepted))
+
+	accepted, err = readRouteBaseline(t.TempDir() + "/missing")
+	assert.NoError(t, err)
+	assert.Len(t, newRouteProblems(problems, accepted), 2)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+// Deps are the collaborators NewRouter wires into the handlers.
+// Tests swap them for fakes to drive every endpoint through httptest.
+type Deps struct {
+	Config   *Config
+	Redis    redis.Cmdable
+	Uploads  Storage
+	Profiles Storage
+	Clock    func() time.Time
+	Logger   *log.Logger
+	Secrets  SecretProvider
+	Users    UserStore
+	// Lockouts counts wrong admin passwords across reloads. NewRouter
+	// starts a new table when it is nil, shared by /admin and /debug.
+	Lockouts *lockouts
+	// Routes learns the module of every route for /debug/routes and
+	// /openapi.json. NewRouter starts a new index when it is nil.
+	Routes *routeIndex
+
+	// Templates is the HTML template set built by parseTemplates.
+	Templates *template.Template
+}
+
+// logger returns the Logger of module, writing to d.Logger.
+func (d Deps) logger(module string) *Logger {
+	return newLogger(module, d.Logger)
+}
+
+// Storage persists uploaded files.
+type Storage interface {
+	Save(file *multipart.FileHeader, name string) error
+}
+
+// dirStorage saves files into a directory on the local disk.
+type dirStorage string
+
+func (d dirStorage) Save(file *multipart.FileHeader, name string) error {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(filepath.Join(string(d), filepath.Base(name)))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// NewRouter builds the main engine and mounts every enabled module.
+func NewRouter(deps Deps) *gin.Engine {
+	logger := deps.logger("router")
+	if deps.Routes == nil {
+		deps.Routes = &routeIndex{}
+	}
+	if deps.Lockouts == nil {
+		deps.Lockouts = newLockouts()
+	}
+
+	router := gin.New()
+	// Route introspection needs to see the chain before anything runs
+	router.Use(routeProbe())
+	// Tag every request first, so all later log lines can name it
+	router.Use(requestID())
+	// Custom Log Format: one JSON line per request
+	router.Use(accessLog(gin.DefaultWriter, deps.Config.Log, deps.Config.Servers.Main.AccessLog))
+
+	// Upload files
+	router.MaxMultipartMemory = deps.Config.Upload.MaxMemory
+
+	// Custom Recovery behavior
+	router.Use(recovery(deps.Config.profile(), deps.logger("http"), deps.Config.redactor()))
+
+	// Server-side sessions for sessions.Get
+	router.Use(sessionMiddleware(deps))
+
+	// HTML rendering
+	// Every page shares one template set, see parseTemplates.
+	router.SetHTMLTemplate(deps.Templates)
+	// JSON problems or the error page for unmatched paths and methods
+	handleUnmatched(router, deps.Templates)
+
+	// Don't trust all proxies
+	// router.SetTrustedProxies([]string{"192.168.1.2"})
+	// router.SetTrustedProxies([]string{"192.168.1.157"})
+	// router.TrustedPlatform = gin.PlatformGoogleAppEngine
+	if err := router.SetTrustedProxies(deps.Config.Proxy.TrustedProxies); err != nil {
+		logger.Errorf("trusted proxies: %v", err)
+	}
+	router.TrustedPlatform = deps.Config.Proxy.TrustedPlatform
+
+	for _, m := range modules(router, deps) {
+		mc := deps.Config.Modules.get(m.Name())
+		if !mc.Enabled {
+			continue
+		}
+		m.Register(router.Group(mc.Prefix))
+		deps.Routes.addGroup(router, m.Name())
+	}
+	deps.Routes.addEngine("main", router)
+
+	return router
+}
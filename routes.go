@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeInfo describes one route for /debug/routes and the routes command.
+type routeInfo struct {
+	Server  string `json:"server"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+	// Middleware is the handler chain in front of Handler.
+	Middleware []string `json:"middleware"`
+	// Group is the module that registered the route.
+	Group string `json:"group,omitempty"`
+	// Auth is the kind of authentication the chain requires, if any.
+	Auth string `json:"auth,omitempty"`
+	// Binds are the request struct types the handler binds.
+	Binds []string `json:"binds,omitempty"`
+}
+
+// routeMeta holds what the route tree doesn't know: the request types of
+// handlers and the kind of auth middleware, both by function name, and the
+// request types of single routes by method and path.
+var routeMeta = struct {
+	sync.RWMutex
+	binds      map[string][]reflect.Type
+	routeBinds map[string][]reflect.Type
+	auth       map[string]string
+}{binds: map[string][]reflect.Type{}, routeBinds: map[string][]reflect.Type{}, auth: map[string]string{}}
+
+func funcName(f gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// binds records the request structs handler binds and returns it unchanged.
+func binds(handler gin.HandlerFunc, requests ...interface{}) gin.HandlerFunc {
+	types := make([]reflect.Type, len(requests))
+	for i, r := range requests {
+		types[i] = reflect.TypeOf(r)
+	}
+	routeMeta.Lock()
+	defer routeMeta.Unlock()
+	routeMeta.binds[funcName(handler)] = types
+	return handler
+}
+
+// bindsRoute records the request structs of the route method relativePath
+// of group. It wins over binds, for handlers that serve several routes and
+// bind differently on each.
+func bindsRoute(group *gin.RouterGroup, method, relativePath string, requests ...interface{}) {
+	types := make([]reflect.Type, len(requests))
+	for i, r := range requests {
+		types[i] = reflect.TypeOf(r)
+	}
+	routeMeta.Lock()
+	defer routeMeta.Unlock()
+	routeMeta.routeBinds[method+" "+path.Join(group.BasePath(), relativePath)] = types
+}
+
+// boundTypes returns the request structs recorded for a route. The caller
+// holds routeMeta's lock.
+func boundTypes(method, path, handler string) []reflect.Type {
+	if types, ok := routeMeta.routeBinds[method+" "+path]; ok {
+		return types
+	}
+	return routeMeta.binds[handler]
+}
+
+// requiresAuth marks middleware as authentication of the given kind and
+// returns it unchanged.
+func requiresAuth(kind string, middleware gin.HandlerFunc) gin.HandlerFunc {
+	routeMeta.Lock()
+	defer routeMeta.Unlock()
+	routeMeta.auth[funcName(middleware)] = kind
+	return middleware
+}
+
+// routeIndex knows the engines being served and the module of each main
+// engine route. It is filled while the engines are built.
+type routeIndex struct {
+	mu      sync.RWMutex
+	engines []namedEngine
+	groups  map[string]string
+}
+
+type namedEngine struct {
+	name   string
+	engine *gin.Engine
+}
+
+func (idx *routeIndex) addEngine(name string, engine *gin.Engine) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.engines = append(idx.engines, namedEngine{name, engine})
+}
+
+// addGroup records that group registered every route of engine not
+// yet known.
+func (idx *routeIndex) addGroup(engine *gin.Engine, group string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.groups == nil {
+		idx.groups = map[string]string{}
+	}
+	for _, r := range engine.Routes() {
+		if _, ok := idx.groups[r.Method+" "+r.Path]; !ok {
+			idx.groups[r.Method+" "+r.Path] = group
+		}
+	}
+}
+
+// Routes describes every route of every engine.
+func (idx *routeIndex) Routes() []routeInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	routeMeta.RLock()
+	defer routeMeta.RUnlock()
+
+	var routes []routeInfo
+	for _, e := range idx.engines {
+		list := e.engine.Routes()
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Path != list[j].Path {
+				return list[i].Path < list[j].Path
+			}
+			return list[i].Method < list[j].Method
+		})
+		for _, r := range list {
+			info := routeInfo{Server: e.name, Method: r.Method, Path: r.Path, Handler: r.Handler, Middleware: []string{}}
+			if e.name == "main" {
+				info.Group = idx.groups[r.Method+" "+r.Path]
+			}
+			if chain, ok := probeRoute(e.engine, r.Method, r.Path); ok && len(chain) > 0 {
+				info.Middleware = chain[:len(chain)-1]
+			}
+			for _, name := range info.Middleware {
+				if kind, ok := routeMeta.auth[name]; ok {
+					info.Auth = kind
+				}
+			}
+			for _, t := range boundTypes(r.Method, r.Path, r.Handler) {
+				info.Binds = append(info.Binds, t.String())
+			}
+			routes = append(routes, info)
+		}
+	}
+	return routes
+}
+
+type routeProbeKey struct{}
+
+// routeProbeResult is what routeProbe saw of a request.
+type routeProbeResult struct {
+	path     string
+	handlers []string
+}
+
+// routeProbe must be the first middleware of an engine. On the in-process
+// requests of probeRoute it records the handler chain and stops, so no
+// handler runs; other requests pass through.
+func routeProbe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if res, ok := c.Request.Context().Value(routeProbeKey{}).(*routeProbeResult); ok {
+			res.path = c.FullPath()
+			// The probe itself is not part of the chain.
+			res.handlers = c.HandlerNames()[1:]
+			c.Abort()
+		}
+	}
+}
+
+// probeRoute returns the handler names engine runs for a request to the
+// route pattern path, or false when such a request reaches another route.
+func probeRoute(engine *gin.Engine, method, path string) ([]string, bool) {
+	res := probe(engine, method, samplePath(path))
+	return res.handlers, res.path == path
+}
+
+// probe sends an in-process request for urlPath through engine and returns
+// what routeProbe saw. Its path is empty when no route matched.
+func probe(engine *gin.Engine, method, urlPath string) *routeProbeResult {
+	res := &routeProbeResult{}
+	req := (&http.Request{
+		Method: method,
+		URL:    &url.URL{Path: urlPath},
+		Header: http.Header{},
+	}).WithContext(context.WithValue(context.Background(), routeProbeKey{}, res))
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	return res
+}
+
+// samplePath fills the parameters of a route pattern with a value.
+func samplePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "x"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// collectRoutes builds every engine and describes their routes.
+func collectRoutes(deps Deps) []routeInfo {
+	idx := &routeIndex{}
+	deps.Routes = idx
+	NewRouter(deps)
+	idx.addEngine("server01", router8081(deps.Config, deps.Templates))
+	idx.addEngine("server02", router8082(deps.Config, deps.Templates))
+	return idx.Routes()
+}
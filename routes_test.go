@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	deps := testDeps()
+	deps.Routes = &routeIndex{}
+	router := NewRouter(deps)
+	deps.Routes.addEngine("server01", router8081(deps.Config, deps.Templates))
+	deps.Routes.addEngine("server02", router8082(deps.Config, deps.Templates))
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	assert.Equal(t, http.StatusUnauthorized, perform(router, req).Code)
+	req.SetBasicAuth("foo", "bar")
+	w := perform(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var routes []routeInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+
+	byRoute := map[string]routeInfo{}
+	for _, r := range routes {
+		byRoute[r.Server+" "+r.Method+" "+r.Path] = r
+	}
+	assert.Contains(t, byRoute, "server01 GET /")
+	assert.Contains(t, byRoute, "server02 GET /")
+
+	secrets := byRoute["main GET /admin/secrets"]
+	assert.Equal(t, "admin", secrets.Group)
+	assert.Equal(t, "basic", secrets.Auth)
+	assert.Contains(t, secrets.Middleware, "kopever/gin-demo.requestID.func1")
+
+	login := byRoute["main POST /loginJSON"]
+	assert.Equal(t, "auth", login.Group)
+	assert.Empty(t, login.Auth)
+	assert.Equal(t, []string{"main.Login"}, login.Binds)
+	assert.Equal(t, []string{"main.submitV1", "main.submitV2"}, byRoute["main POST /api/submit"].Binds)
+	assert.Equal(t, []string{"main.submitV2"}, byRoute["main POST /v2/submit"].Binds)
+}
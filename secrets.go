@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrSecretNotFound is returned when no provider holds the requested secret.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves secrets such as passwords and signing keys by name.
+type SecretProvider interface {
+	Secret(name string) (Secret, error)
+}
+
+// Secret is a sensitive value. It prints masked through fmt, JSON and YAML,
+// so it can't leak into logs by accident; use Reveal to get the value.
+type Secret string
+
+const secretMask = "[REDACTED]"
+
+func (s Secret) Reveal() string { return string(s) }
+
+func (s Secret) String() string   { return secretMask }
+func (s Secret) GoString() string { return secretMask }
+
+func (s Secret) MarshalText() ([]byte, error) { return []byte(secretMask), nil }
+
+// fileSecrets reads one secret per file, the layout of Docker and
+// Kubernetes secret mounts.
+type fileSecrets string
+
+func (d fileSecrets) Secret(name string) (Secret, error) {
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("secret %q: invalid name", name)
+	}
+	b, err := os.ReadFile(filepath.Join(string(d), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return Secret(strings.TrimRight(string(b), "\r\n")), nil
+}
+
+// envSecrets reads secrets from environment variables. The name
+// "redis_password" is looked up as <prefix>REDIS_PASSWORD.
+type envSecrets string
+
+func (p envSecrets) Secret(name string) (Secret, error) {
+	key := string(p) + strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name))
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return Secret(v), nil
+}
+
+// encryptedSecrets is a local YAML file mapping names to AES-256-GCM
+// encrypted values, see encryptSecret.
+type encryptedSecrets struct {
+	aead   cipher.AEAD
+	values map[string]string
+}
+
+func loadEncryptedSecrets(path string, key []byte) (*encryptedSecrets, error) {
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &encryptedSecrets{aead: aead, values: values}, nil
+}
+
+func (e *encryptedSecrets) Secret(name string) (Secret, error) {
+	v, ok := e.values[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(b) < e.aead.NonceSize() {
+		return "", fmt.Errorf("secret %q: malformed value", name)
+	}
+	nonce, sealed := b[:e.aead.NonceSize()], b[e.aead.NonceSize():]
+	// The name is authenticated too, so values can't be swapped between keys.
+	plain, err := e.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+	return Secret(plain), nil
+}
+
+// encryptSecret returns the value to store under name in an encrypted
+// secrets file.
+func encryptSecret(key []byte, name, value string) (string, error) {
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name))), nil
+}
+
+func newSecretsAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readSecretsKey loads the base64 encoded key of the encrypted secrets file
+// from path, or from GIN_DEMO_SECRETS_KEY when path is empty.
+func readSecretsKey(path string) ([]byte, error) {
+	encoded := os.Getenv("GIN_DEMO_SECRETS_KEY")
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(b)
+	}
+	if encoded == "" {
+		return nil, errors.New("no secrets key: set secrets.key_file or GIN_DEMO_SECRETS_KEY")
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+}
+
+// chainSecrets asks each provider in turn.
+type chainSecrets []SecretProvider
+
+func (c chainSecrets) Secret(name string) (Secret, error) {
+	for _, p := range c {
+		s, err := p.Secret(name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		return s, err
+	}
+	return "", fmt.Errorf("secret %q: %w", name, ErrSecretNotFound)
+}
+
+// newSecretProvider chains the providers listed in cfg.
+func newSecretProvider(cfg SecretsConfig) (SecretProvider, error) {
+	var chain chainSecrets
+	for _, name := range cfg.Providers {
+		switch name {
+		case "file":
+			chain = append(chain, fileSecrets(cfg.Dir))
+		case "env":
+			chain = append(chain, envSecrets(cfg.EnvPrefix))
+		case "encrypted":
+			key, err := readSecretsKey(cfg.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			p, err := loadEncryptedSecrets(cfg.File, key)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, p)
+		default:
+			return nil, fmt.Errorf("unknown secrets provider %q", name)
+		}
+	}
+	return chain, nil
+}
+
+// optionalSecret is like SecretProvider.Secret but treats a missing secret
+// as empty.
+func optionalSecret(p SecretProvider, name string) (Secret, error) {
+	if name == "" {
+		return "", nil
+	}
+	s, err := p.Secret(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		return "", nil
+	}
+	return s, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretIsMasked(t *testing.T) {
+	s := Secret("hunter2")
+	b, _ := json.Marshal(struct{ Password Secret }{s})
+
+	assert.Equal(t, "hunter2", s.Reveal())
+	assert.NotContains(t, fmt.Sprintf("%v %s %+v %#v", s, s, s, s), "hunter2")
+	assert.NotContains(t, string(b), "hunter2")
+}
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "redis_password"), []byte("from-file\n"), 0o600))
+	t.Setenv("TEST_SECRET_REDIS_PASSWORD", "from-env")
+	t.Setenv("TEST_SECRET_ADMIN_ACCOUNTS", "foo:bar")
+
+	key := make([]byte, 32)
+	sealed, err := encryptSecret(key, "jwt_key", "from-encrypted")
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "secrets.enc.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("jwt_key: "+sealed+"\n"), 0o600))
+	keyFile := filepath.Join(dir, "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"), 0o600))
+
+	p, err := newSecretProvider(SecretsConfig{
+		Providers: []string{"file", "env", "encrypted"},
+		Dir:       dir,
+		EnvPrefix: "TEST_SECRET_",
+		File:      file,
+		KeyFile:   keyFile,
+	})
+	assert.NoError(t, err)
+
+	for name, want := range map[string]string{
+		"redis_password": "from-file",
+		"admin_accounts": "foo:bar",
+		"jwt_key":        "from-encrypted",
+	} {
+		s, err := p.Secret(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want, s.Reveal(), name)
+	}
+
+	_, err = p.Secret("missing")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+	_, err = p.Secret("../etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestEncryptedSecretBoundToName(t *testing.T) {
+	key := make([]byte, 32)
+	sealed, err := encryptSecret(key, "a", "value")
+	assert.NoError(t, err)
+
+	aead, _ := newSecretsAEAD(key)
+	p := &encryptedSecrets{aead: aead, values: map[string]string{"b": sealed}}
+	_, err = p.Secret("b")
+	assert.Error(t, err)
+}
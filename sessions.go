@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+// Session is the server-side state of a browser, kept in Redis under
+// sessionKeyPrefix plus its ID. The cookie only carries the signed ID.
+type Session struct {
+	id     string
+	record sessionRecord
+	// oldID is the ID to delete on save after Regenerate.
+	oldID     string
+	destroyed bool
+	// store is nil for sessions that are never saved, like those of
+	// engines without the session middleware.
+	store *sessionStore
+	c     *gin.Context
+}
+
+// sessionRecord is what Redis keeps of a session.
+type sessionRecord struct {
+	Values   map[string]string `json:"values"`
+	Created  time.Time         `json:"created_at"`
+	LastSeen time.Time         `json:"last_seen_at"`
+}
+
+const (
+	sessionKeyPrefix = "gin-demo:session:"
+	// sessionKey holds the *Session in the gin context.
+	sessionKey = "session"
+)
+
+// ID is empty until the session holds something.
+func (s *Session) ID() string { return s.id }
+
+func (s *Session) Get(key string) string { return s.record.Values[key] }
+
+func (s *Session) Set(key, value string) {
+	if s.record.Values == nil {
+		s.record.Values = map[string]string{}
+	}
+	s.record.Values[key] = value
+	if s.id == "" {
+		s.id, s.destroyed = randomToken(32), false
+		s.setCookie()
+	}
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.record.Values, key)
+}
+
+// Regenerate moves the session to a new ID, so an ID planted before a
+// login is worthless after it.
+func (s *Session) Regenerate() {
+	if s.id == "" {
+		return
+	}
+	if s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = randomToken(32)
+	s.setCookie()
+}
+
+// Destroy drops the session and its cookie.
+func (s *Session) Destroy() {
+	if s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id, s.record.Values, s.destroyed = "", nil, true
+	if s.store != nil {
+		s.store.writeCookie(s.c, "", -1)
+	}
+}
+
+func (s *Session) setCookie() {
+	if s.store != nil {
+		s.store.writeCookie(s.c, s.store.sign(s.id), int(s.store.cfg.AbsoluteTTL/time.Second))
+	}
+}
+
+// sessionHelper gives handlers the Session of a request, as sessions.Get.
+type sessionHelper struct{}
+
+var sessions sessionHelper
+
+// Get returns the session of c. Engines without the session middleware get
+// an empty session that is never saved.
+func (sessionHelper) Get(c *gin.Context) *Session {
+	if s, ok := c.Get(sessionKey); ok {
+		return s.(*Session)
+	}
+	s := &Session{c: c}
+	c.Set(sessionKey, s)
+	return s
+}
+
+// sessionStore loads and saves the sessions of the session middleware.
+type sessionStore struct {
+	cfg   SessionsConfig
+	key   []byte
+	redis redis.Cmdable
+	clock func() time.Time
+}
+
+// sign returns the cookie value of id: the ID and its HMAC-SHA256.
+func (st *sessionStore) sign(id string) string {
+	mac := hmac.New(sha256.New, st.key)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the ID of a cookie value with a valid signature.
+func (st *sessionStore) verify(value string) (string, bool) {
+	id, _, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(st.sign(id)), []byte(value))
+}
+
+// writeCookie replaces the session cookie of the response.
+func (st *sessionStore) writeCookie(c *gin.Context, value string, maxAge int) {
+	header := c.Writer.Header()
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		if !strings.HasPrefix(cookie, st.cfg.Cookie+"=") {
+			header.Add("Set-Cookie", cookie)
+		}
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     st.cfg.Cookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   st.cfg.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// load returns the live session of the request's cookie, or a new one.
+func (st *sessionStore) load(c *gin.Context) (*Session, error) {
+	s := &Session{store: st, c: c}
+	value, err := c.Cookie(st.cfg.Cookie)
+	if err != nil {
+		return s, nil
+	}
+	id, ok := st.verify(value)
+	if !ok {
+		return s, nil
+	}
+	b, err := st.redis.Get(c.Request.Context(), sessionKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	var rec sessionRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return s, err
+	}
+	now := st.clock()
+	if !now.Before(rec.Created.Add(st.cfg.AbsoluteTTL)) || !now.Before(rec.LastSeen.Add(st.cfg.IdleTTL)) {
+		s.oldID = id
+		return s, nil
+	}
+	s.id, s.record = id, rec
+	return s, nil
+}
+
+// save stores s with the shorter of its idle and absolute expiry, and
+// drops the ID it had before a Regenerate or Destroy.
+func (st *sessionStore) save(ctx context.Context, s *Session) error {
+	if s.oldID != "" && s.oldID != s.id {
+		if err := st.redis.Del(ctx, sessionKeyPrefix+s.oldID).Err(); err != nil {
+			return err
+		}
+	}
+	if s.id == "" || s.destroyed {
+		return nil
+	}
+	now := st.clock()
+	if s.record.Created.IsZero() {
+		s.record.Created = now
+	}
+	s.record.LastSeen = now
+	ttl := s.record.Created.Add(st.cfg.AbsoluteTTL).Sub(now)
+	if ttl > st.cfg.IdleTTL {
+		ttl = st.cfg.IdleTTL
+	}
+	b, err := json.Marshal(s.record)
+	if err != nil {
+		return err
+	}
+	return st.redis.Set(ctx, sessionKeyPrefix+s.id, b, ttl).Err()
+}
+
+// sessionMiddleware loads the session of each request for sessions.Get and
+// saves it afterwards, which also keeps it from going idle. Requests
+// without a session cookie cost nothing until a handler sets a value.
+// Without a usable key from sessions.key_secret sessions are never saved.
+func sessionMiddleware(deps Deps) gin.HandlerFunc {
+	cfg := deps.Config.Sessions
+	logger := deps.logger("sessions")
+	secret, err := deps.Secrets.Secret(cfg.KeySecret)
+	if err == nil && len(secret.Reveal()) < 32 {
+		err = errors.New("the key must be at least 32 bytes")
+	}
+	if err != nil {
+		logger.Warnf("sessions: %v, sessions are not saved", err)
+		return func(c *gin.Context) { c.Next() }
+	}
+	st := &sessionStore{cfg: cfg, key: []byte(secret.Reveal()), redis: deps.Redis, clock: deps.Clock}
+
+	return func(c *gin.Context) {
+		s, err := st.load(c)
+		if err != nil {
+			logger.For(c).Errorf("session load: %v", err)
+		}
+		c.Set(sessionKey, s)
+		c.Next()
+		if err := st.save(c.Request.Context(), s); err != nil {
+			logger.For(c).Errorf("session save: %v", err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	deps := testDeps()
+	now := deps.Clock()
+	deps.Clock = func() time.Time { return now }
+	rdb := deps.Redis.(*fakeRedis)
+	router := NewRouter(deps)
+
+	var cookie *http.Cookie
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := perform(router, req)
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "session" {
+				cookie = c
+			}
+		}
+		return w
+	}
+
+	// Nothing is stored until a handler sets a value.
+	call(http.MethodGet, "/index", "")
+	assert.Nil(t, cookie)
+	assert.JSONEq(t, `{"user": "", "visits": 1}`, call(http.MethodGet, "/session", "").Body.String())
+	if !assert.NotNil(t, cookie) {
+		return
+	}
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Empty(t, cookie.Domain)
+	assert.JSONEq(t, `{"user": "", "visits": 2}`, call(http.MethodGet, "/session", "").Body.String())
+
+	// Logging in moves the session to a new ID.
+	before := cookie.Value
+	id, _, _ := strings.Cut(before, ".")
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/loginJSON", `{"user": "manu", "password": "123"}`).Code)
+	assert.NotEqual(t, before, cookie.Value)
+	assert.NotContains(t, rdb.data, sessionKeyPrefix+id)
+	assert.Contains(t, call(http.MethodGet, "/index", "").Body.String(), "Logged in as manu")
+	assert.JSONEq(t, `{"user": "manu", "visits": 3}`, call(http.MethodGet, "/session", "").Body.String())
+
+	// A forged signature starts over.
+	login := cookie
+	cookie = &http.Cookie{Name: "session", Value: id + ".forged"}
+	assert.JSONEq(t, `{"user": "", "visits": 1}`, call(http.MethodGet, "/session", "").Body.String())
+
+	// Sessions end after idle_ttl without requests, and after absolute_ttl
+	// regardless.
+	cookie = login
+	now = now.Add(29 * time.Minute)
+	assert.NotContains(t, call(http.MethodGet, "/session", "").Body.String(), `"visits":1`)
+	now = now.Add(31 * time.Minute)
+	assert.JSONEq(t, `{"user": "", "visits": 1}`, call(http.MethodGet, "/session", "").Body.String())
+	for i := 0; i < 49; i++ {
+		now = now.Add(29 * time.Minute)
+		call(http.MethodGet, "/session", "")
+	}
+	assert.JSONEq(t, `{"user": "", "visits": 51}`, call(http.MethodGet, "/session", "").Body.String())
+	now = now.Add(29 * time.Minute)
+	assert.JSONEq(t, `{"user": "", "visits": 1}`, call(http.MethodGet, "/session", "").Body.String())
+}
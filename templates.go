@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+)
+
+// htmlTemplates lists every page template of the main engine. Gin keeps only
+// the last LoadHTML* call, so they are parsed into a single set instead.
+// Files that define their own names are registered under their path.
+var htmlTemplates = []struct {
+	name        string
+	file        string
+	left, right string
+}{
+	{name: "checkbox.html", file: "checkbox.html"},
+	{name: "index.tmpl", file: "templates/index.tmpl"},
+	{name: "error.tmpl", file: "templates/error.tmpl"},
+	{name: "template1.tmpl", file: "templates/template1.tmpl"},
+	{name: "template2.tmpl", file: "templates/template2.tmpl"},
+	{name: "templates/posts/index.tmpl", file: "templates/posts/index.tmpl"},
+	{name: "templates/users/index.tmpl", file: "templates/users/index.tmpl"},
+	// Custom Delimiters
+	{name: "raw.tmpl", file: "testdata/template/raw.tmpl", left: "{[{", right: "}]}"},
+}
+
+const http2Template = `
+<html>
+<head>
+  <title>Https Test</title>
+  <script src="/assets/app.js"></script>
+</head>
+<body>
+  <h1 style="color:red;">Welcome, Ginner!</h1>
+</body>
+</html>
+`
+
+// parseTemplates reads and parses all htmlTemplates from the working directory.
+func parseTemplates() (*template.Template, error) {
+	// Custom Template Funcs
+	t := template.New("").Funcs(template.FuncMap{
+		"formatAsDate": formatAsDate,
+	})
+	for _, ht := range htmlTemplates {
+		b, err := os.ReadFile(ht.file)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", ht.name, err)
+		}
+		if _, err := t.New(ht.name).Delims(ht.left, ht.right).Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("template %s: %w", ht.name, err)
+		}
+	}
+	if _, err := t.New("http2").Parse(http2Template); err != nil {
+		return nil, fmt.Errorf("template http2: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+// Token is what a token store knows about a bearer token.
+type Token struct {
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+	// ExpiresAt is zero for tokens that never expire.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Session is the login session of an access token, see jwtIssuer.
+	Session string `json:"session,omitempty"`
+	// Source is sourceUser for the access tokens of logins and empty for
+	// the tokens of a store, which can't claim another source.
+	Source string `json:"-"`
+}
+
+var (
+	// ErrTokenNotFound is returned for tokens a store doesn't know.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenInvalid is returned for malformed or badly signed tokens.
+	ErrTokenInvalid = errors.New("token invalid")
+	// ErrTokenRevoked is returned for tokens of a revoked session.
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// TokenStore looks up bearer tokens. Stores keep the SHA-256 of a token,
+// never the token itself, as the key.
+type TokenStore interface {
+	Token(ctx context.Context, value string) (Token, error)
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretTokens are the tokens listed in a secret.
+type secretTokens map[string]Token
+
+func (s secretTokens) Token(ctx context.Context, value string) (Token, error) {
+	if t, ok := s[hashToken(value)]; ok {
+		return t, nil
+	}
+	return Token{}, ErrTokenNotFound
+}
+
+// parseTokens reads "token subject scope,scope [expires_at]" lines, with
+// expires_at in RFC 3339.
+func parseTokens(s Secret) (secretTokens, error) {
+	tokens := secretTokens{}
+	sc := bufio.NewScanner(strings.NewReader(s.Reveal()))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		// Never echo the line, it holds a token.
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("tokens line %d: want token subject scopes [expires_at]", n)
+		}
+		t := Token{Subject: fields[1], Scopes: strings.Split(fields[2], ",")}
+		if len(fields) == 4 {
+			expires, err := time.Parse(time.RFC3339, fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("tokens line %d: expires_at: %w", n, err)
+			}
+			t.ExpiresAt = expires
+		}
+		tokens[hashToken(fields[0])] = t
+	}
+	return tokens, sc.Err()
+}
+
+// redisTokens keeps each token as JSON under tokenKeyPrefix plus its hash.
+type redisTokens struct {
+	redis redis.Cmdable
+}
+
+const tokenKeyPrefix = "gin-demo:token:"
+
+func (s redisTokens) Token(ctx context.Context, value string) (Token, error) {
+	b, err := s.redis.Get(ctx, tokenKeyPrefix+hashToken(value)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Token{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	var t Token
+	err = json.Unmarshal(b, &t)
+	return t, err
+}
+
+// Principal is who a request authenticated as.
+type Principal struct {
+	// Source is where Subject comes from, see sourceToken.
+	Source  string   `json:"source"`
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+	// ExpiresAt is zero when the credentials never expire.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Session   string    `json:"session,omitempty"`
+	// Roles and Permissions come from the rbac policy, see rbacPolicy.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// principalKey holds the Principal in the gin context.
+const principalKey = "principal"
+
+// principalFrom returns the Principal authenticated for c.
+func principalFrom(c *gin.Context) (Principal, bool) {
+	p, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	principal, ok := p.(Principal)
+	return principal, ok
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or
+// of the token query parameter when allowQuery is set.
+func bearerToken(req *http.Request, allowQuery bool) (string, bool) {
+	if h := req.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", false
+		}
+		return strings.TrimSpace(token), true
+	}
+	if allowQuery {
+		if token := req.URL.Query().Get("token"); token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// bearerAuth authenticates requests with a token of store. It stores the
+// Principal with its roles from policy in the context and the subject as
+// gin.AuthUserKey, and answers missing, unknown or expired tokens with 401.
+func bearerAuth(store TokenStore, policy *rbacPolicy, clock func() time.Time, allowQuery bool, logger *Logger) gin.HandlerFunc {
+	return requiresAuth("bearer", func(c *gin.Context) {
+		value, ok := bearerToken(c.Request, allowQuery)
+		if !ok {
+			abortUnauthorized(c, "", "A bearer token is required.")
+			return
+		}
+		t, err := store.Token(c.Request.Context(), value)
+		switch {
+		case errors.Is(err, ErrTokenNotFound):
+			abortUnauthorized(c, "invalid_token", "The token is unknown.")
+			return
+		case errors.Is(err, ErrTokenInvalid):
+			abortUnauthorized(c, "invalid_token", "The token is invalid.")
+			return
+		case errors.Is(err, ErrTokenRevoked):
+			abortUnauthorized(c, "invalid_token", "The token was revoked.")
+			return
+		case err != nil:
+			logger.For(c).Errorf("token lookup: %v", err)
+			c.Error(err)
+			abortProblem(c, newProblem(c, http.StatusServiceUnavailable, "Tokens can't be checked right now."))
+			return
+		}
+		if !t.ExpiresAt.IsZero() && !clock().Before(t.ExpiresAt) {
+			abortUnauthorized(c, "invalid_token", "The token expired.")
+			return
+		}
+		source := t.Source
+		if source == "" {
+			source = sourceToken
+		}
+		if authorize(c, policy, Principal{Source: source, Subject: t.Subject, Scopes: t.Scopes, ExpiresAt: t.ExpiresAt, Session: t.Session}) {
+			c.Next()
+		}
+	})
+}
+
+// abortUnauthorized sends the RFC 6750 challenge with a 401 problem.
+func abortUnauthorized(c *gin.Context, code, detail string) {
+	challenge := `Bearer realm="gin-demo"`
+	if code != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, code, detail)
+	}
+	c.Header("WWW-Authenticate", challenge)
+	abortProblem(c, newProblem(c, http.StatusUnauthorized, detail))
+}
+
+// abortProblem stops the chain with p as a problem document.
+func abortProblem(c *gin.Context, p problem) {
+	writeProblem(c, nil, p)
+	c.Abort()
+}
+
+// tokenAuth guards routes with the access tokens of issuer, when set, and
+// the token store of tokens.store. Without usable tokens every request is
+// refused.
+func tokenAuth(deps Deps, issuer *jwtIssuer) gin.HandlerFunc {
+	cfg := deps.Config.Tokens
+	logger := deps.logger("router")
+	var store TokenStore = redisTokens{redis: deps.Redis}
+	if cfg.Store == "secret" {
+		secret, err := deps.Secrets.Secret(cfg.Secret)
+		tokens := secretTokens{}
+		if err == nil {
+			tokens, err = parseTokens(secret)
+		}
+		if err != nil {
+			logger.Warnf("tokens: %v, token routes refuse every request", err)
+		}
+		store = tokens
+	}
+	if issuer != nil {
+		store = jwtOrStore{jwt: issuer, store: store}
+	}
+	return bearerAuth(store, newRBACPolicy(deps.Config.RBAC), deps.Clock, cfg.AllowQuery, logger)
+}
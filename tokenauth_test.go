@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenAuth(t *testing.T) {
+	router := NewRouter(testDeps())
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return perform(router, req)
+	}
+
+	w := call(http.MethodPost, "/ping", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="gin-demo"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+	// The query token is off by default.
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/ping?token=okay", "", "").Code)
+
+	w = call(http.MethodPost, "/ping", "nope", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	w = call(http.MethodPost, "/ping", "old", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "The token expired.")
+
+	w = call(http.MethodPost, "/ping", "okay", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Authed pong for demo", w.Body.String())
+
+	w = call(http.MethodPost, "/submit", "okay", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var msg message
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &msg))
+	assert.Equal(t, "demo", msg.Author)
+
+	// The reader may read but not write.
+	w = call(http.MethodPost, "/submit", "reader", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="messages:write"`)
+	w = call(http.MethodPost, "/read", "reader", `{"id": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"text":"hello"`)
+
+	w = call(http.MethodGet, "/testing/analytics", "okay", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"messages":1`)
+	assert.Contains(t, w.Body.String(), `"subject":"demo"`)
+}
+
+func TestTokenStores(t *testing.T) {
+	tokens, err := parseTokens("# comment\nabc alice read,write 2030-01-01T00:00:00Z\n")
+	assert.NoError(t, err)
+	tok, err := tokens.Token(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, Token{Subject: "alice", Scopes: []string{"read", "write"}, ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, tok)
+	_, err = tokens.Token(context.Background(), "abd")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	_, err = parseTokens("secret-token-value\n")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token-value")
+
+	rdb := &fakeRedis{data: map[string]string{}}
+	rdb.data[tokenKeyPrefix+hashToken("xyz")] = `{"subject": "bob", "scopes": ["ping"]}`
+	tok, err = redisTokens{redis: rdb}.Token(context.Background(), "xyz")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", tok.Subject)
+	_, err = redisTokens{redis: rdb}.Token(context.Background(), "abc")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?token=q", nil)
+	_, ok := bearerToken(req, false)
+	assert.False(t, ok)
+	token, ok := bearerToken(req, true)
+	assert.True(t, ok)
+	assert.Equal(t, "q", token)
+
+	req.Header.Set("Authorization", "bearer h")
+	token, _ = bearerToken(req, true)
+	assert.Equal(t, "h", token)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	_, ok = bearerToken(req, true)
+	assert.False(t, ok)
+}
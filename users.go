@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account of the login endpoints.
+type User struct {
+	Name string `json:"name"`
+	// PasswordHash is a bcrypt hash or an argon2id hash in PHC format.
+	PasswordHash string    `json:"password_hash"`
+	Created      time.Time `json:"created_at"`
+}
+
+var (
+	// ErrUserNotFound is returned for names a store doesn't know.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a taken name.
+	ErrUserExists = errors.New("user exists")
+)
+
+// UserStore keeps the accounts of the login endpoints.
+type UserStore interface {
+	User(ctx context.Context, name string) (User, error)
+	// Create adds u, or fails with ErrUserExists.
+	Create(ctx context.Context, u User) error
+	// SetPassword replaces the hash of name, or fails with ErrUserNotFound.
+	SetPassword(ctx context.Context, name, hash string) error
+}
+
+// memUsers keeps users in memory; they are gone after a restart.
+type memUsers struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+func newMemUsers() *memUsers {
+	return &memUsers{users: map[string]User{}}
+}
+
+func (m *memUsers) User(ctx context.Context, name string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[name]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *memUsers) Create(ctx context.Context, u User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.Name]; ok {
+		return ErrUserExists
+	}
+	m.users[u.Name] = u
+	return nil
+}
+
+func (m *memUsers) SetPassword(ctx context.Context, name, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[name]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = hash
+	m.users[name] = u
+	return nil
+}
+
+// redisUsers keeps each user as JSON under userKeyPrefix plus its name.
+type redisUsers struct {
+	redis redis.Cmdable
+}
+
+const userKeyPrefix = "gin-demo:user:"
+
+func (s redisUsers) User(ctx context.Context, name string) (User, error) {
+	b, err := s.redis.Get(ctx, userKeyPrefix+name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	var u User
+	err = json.Unmarshal(b, &u)
+	return u, err
+}
+
+func (s redisUsers) Create(ctx context.Context, u User) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	created, err := s.redis.SetNX(ctx, userKeyPrefix+u.Name, b, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// SetPassword may lose a change made at the same time; the last write wins.
+func (s redisUsers) SetPassword(ctx context.Context, name, hash string) error {
+	u, err := s.User(ctx, name)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, userKeyPrefix+name, b, 0).Err()
+}
+
+// newUserStore returns the store of users.store. The memory store starts
+// with the "user:hash" lines of the users.seed_secret secret, or empty when
+// none is named. A named secret that doesn't exist is an error.
+func newUserStore(cfg UsersConfig, rdb redis.Cmdable, secrets SecretProvider, now time.Time) (UserStore, error) {
+	if cfg.Store == "redis" {
+		return redisUsers{redis: rdb}, nil
+	}
+	users := newMemUsers()
+	if cfg.SeedSecret == "" {
+		return users, nil
+	}
+	secret, err := secrets.Secret(cfg.SeedSecret)
+	if err != nil {
+		return nil, fmt.Errorf("users.seed_secret: %w", err)
+	}
+	sc := bufio.NewScanner(strings.NewReader(secret.Reveal()))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok || name == "" || !knownHash(hash) {
+			return nil, fmt.Errorf("users line %d: want user:bcrypt or argon2id hash", n)
+		}
+		users.users[name] = User{Name: name, PasswordHash: hash, Created: now}
+	}
+	return users, sc.Err()
+}
+
+// The argon2id parameters of new hashes, the second recommendation of
+// RFC 9106.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+// hashPassword hashes password with users.hash.
+func hashPassword(cfg UsersConfig, password string) (string, error) {
+	if cfg.Hash == "argon2id" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+	return string(b), err
+}
+
+func knownHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2") || strings.HasPrefix(hash, "$argon2id$")
+}
+
+// checkPassword compares password with hash in constant time.
+func checkPassword(hash, password string) (bool, error) {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errors.New("malformed argon2id hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// errInvalidLogin is returned for unknown users and wrong passwords alike.
+var errInvalidLogin = errors.New("invalid user or password")
+
+// accounts checks, registers and changes the passwords of Logins, the
+// credentials shared by every login endpoint.
+type accounts struct {
+	store UserStore
+	cfg   UsersConfig
+	clock func() time.Time
+	// subjects are the roles of rbac.subjects, whose user: names are
+	// taken.
+	subjects map[string][]string
+
+	// dummy is hashed against for unknown users, so they take as long to
+	// refuse as wrong passwords.
+	dummyOnce sync.Once
+	dummy     string
+}
+
+func newAccounts(deps Deps) *accounts {
+	return &accounts{store: deps.Users, cfg: deps.Config.Users, clock: deps.Clock, subjects: deps.Config.RBAC.Subjects}
+}
+
+// Check returns errInvalidLogin unless l names a user with that password.
+func (a *accounts) Check(ctx context.Context, l Login) error {
+	u, err := a.store.User(ctx, l.User)
+	if errors.Is(err, ErrUserNotFound) {
+		a.dummyOnce.Do(func() { a.dummy, _ = hashPassword(a.cfg, randomToken(16)) })
+		checkPassword(a.dummy, l.Password)
+		return errInvalidLogin
+	}
+	if err != nil {
+		return err
+	}
+	ok, err := checkPassword(u.PasswordHash, l.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidLogin
+	}
+	return nil
+}
+
+// Register creates the user of l, or fails with ErrUserExists. Names the
+// policy grants roles to as user:<name> count as taken, so nobody can
+// register into them.
+func (a *accounts) Register(ctx context.Context, l Login) error {
+	if _, ok := a.subjects[sourceUser+":"+l.User]; ok {
+		return ErrUserExists
+	}
+	hash, err := hashPassword(a.cfg, l.Password)
+	if err != nil {
+		return err
+	}
+	return a.store.Create(ctx, User{Name: l.User, PasswordHash: hash, Created: a.clock().UTC()})
+}
+
+// ChangePassword sets the password of the user of l, after checking l.
+func (a *accounts) ChangePassword(ctx context.Context, l Login, password string) error {
+	if err := a.Check(ctx, l); err != nil {
+		return err
+	}
+	hash, err := hashPassword(a.cfg, password)
+	if err != nil {
+		return err
+	}
+	return a.store.SetPassword(ctx, l.User, hash)
+}
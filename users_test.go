@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAccounts(t *testing.T) {
+	deps := testDeps()
+	deps.Config.RBAC.Subjects["user:grace"] = []string{"writer"}
+	router := NewRouter(deps)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return perform(router, req)
+	}
+
+	// The seeded user logs in with JSON, XML and forms alike.
+	assert.Equal(t, http.StatusOK, post("/loginJSON", `{"user": "manu", "password": "123"}`).Code)
+	req := httptest.NewRequest(http.MethodPost, "/loginXML", strings.NewReader(`<Login><user>manu</user><password>123</password></Login>`))
+	req.Header.Set("Content-Type", "application/xml")
+	assert.Equal(t, http.StatusOK, perform(router, req).Code)
+	req = httptest.NewRequest(http.MethodPost, "/loginForm", strings.NewReader(url.Values{"user": {"manu"}, "password": {"nope"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusUnauthorized, perform(router, req).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/loginJSON", `{"user": "nobody", "password": "123"}`).Code)
+
+	w := post("/register", `{"user": "ada", "password": "lovelace"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"user": "ada"}`, w.Body.String())
+	assert.Equal(t, http.StatusConflict, post("/register", `{"user": "ada", "password": "otherpassword"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/register", `{"user": "bob"}`).Code)
+	assert.Equal(t, http.StatusConflict, post("/register", `{"user": "grace", "password": "takeover"}`).Code, "user:grace has roles")
+	assert.Equal(t, http.StatusBadRequest, post("/register", `{"user": "bob", "password": "short"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/v2/login", `{"user": "ada", "password": "lovelace"}`).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, post("/password", `{"user": "ada", "password": "wrong", "new_password": "analytical"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/password", `{"user": "ada", "password": "lovelace", "new_password": "short"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/password", `{"user": "ada", "password": "lovelace", "new_password": "analytical"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/loginJSON", `{"user": "ada", "password": "lovelace"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/loginJSON", `{"user": "ada", "password": "analytical"}`).Code)
+}
+
+func TestPasswordHashes(t *testing.T) {
+	for _, alg := range []string{"bcrypt", "argon2id"} {
+		hash, err := hashPassword(UsersConfig{Hash: alg, BcryptCost: 4}, "secret")
+		assert.NoError(t, err, alg)
+		assert.True(t, knownHash(hash), alg)
+		ok, err := checkPassword(hash, "secret")
+		assert.NoError(t, err, alg)
+		assert.True(t, ok, alg)
+		ok, err = checkPassword(hash, "Secret")
+		assert.NoError(t, err, alg)
+		assert.False(t, ok, alg)
+	}
+	_, err := checkPassword("$argon2id$v=19$m=x$salt$key", "secret")
+	assert.Error(t, err)
+	_, err = checkPassword("plain", "plain")
+	assert.Error(t, err)
+
+	_, err = newUserStore(UsersConfig{Store: "memory", SeedSecret: "users"}, nil, mapSecrets{"users": "manu:123"}, time.Time{})
+	assert.Error(t, err, "plaintext passwords are refused")
+	_, err = newUserStore(UsersConfig{Store: "memory", SeedSecret: "users"}, nil, mapSecrets{}, time.Time{})
+	assert.ErrorIs(t, err, ErrSecretNotFound, "a named seed secret must exist")
+	_, err = newUserStore(UsersConfig{Store: "memory"}, nil, mapSecrets{}, time.Time{})
+	assert.NoError(t, err)
+}
+
+func TestRedisUsers(t *testing.T) {
+	ctx := context.Background()
+	users := redisUsers{redis: &fakeRedis{data: map[string]string{}}}
+	_, err := users.User(ctx, "ada")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.ErrorIs(t, users.SetPassword(ctx, "ada", "$2a$x"), ErrUserNotFound)
+
+	assert.NoError(t, users.Create(ctx, User{Name: "ada", PasswordHash: "$2a$old"}))
+	assert.ErrorIs(t, users.Create(ctx, User{Name: "ada", PasswordHash: "$2a$other"}), ErrUserExists)
+	assert.NoError(t, users.SetPassword(ctx, "ada", "$2a$new"))
+	u, err := users.User(ctx, "ada")
+	assert.NoError(t, err)
+	assert.Equal(t, "$2a$new", u.PasswordHash)
+}